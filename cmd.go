@@ -1,13 +1,18 @@
 package main
 
 import "os"
+import "bufio"
 import "fmt"
 import "flag"
+import "time"
+import "context"
+import "io"
 import "strings"
 import "path/filepath"
+import "github.com/eugene-eeo/yalmc/lmc"
 
-func mustInt(strs []string) []int {
-	b, err := inputsToInts(strs)
+func mustInt(strs []string, g lmc.Geometry) []int {
+	b, err := g.ParseInputs(strs)
 	if err != nil {
 		toStderr(err)
 		os.Exit(1)
@@ -15,6 +20,17 @@ func mustInt(strs []string) []int {
 	return b
 }
 
+// mustDevices parses the -devices flag, which has to be done
+// once the geometry is known.
+func mustDevices(specs string, g lmc.Geometry) []lmc.Device {
+	ds, err := lmc.ParseDevices(specs, g)
+	if err != nil {
+		toStderr(err)
+		os.Exit(1)
+	}
+	return ds
+}
+
 func toStderr(strings ...interface{}) {
 	fmt.Fprintln(os.Stderr, strings...)
 }
@@ -28,13 +44,14 @@ func mustOpen(filepath string) (fp *os.File) {
 	return
 }
 
-func printMailboxes(vm *context) {
-	row := make([]string, 10)
-	for i := 0; i < 10; i++ {
-		for j := 0; j < 10; j++ {
-			row[j] = fmt.Sprintf("%03d", vm.mem[i*10+j])
+func printMailboxes(w io.Writer, vm *lmc.Machine) {
+	row := []string{}
+	for i, m := range vm.Mem {
+		row = append(row, fmt.Sprintf("%0*d", vm.Geometry.Digits, m))
+		if len(row) == 10 || i == len(vm.Mem)-1 {
+			fmt.Fprintln(w, strings.Join(row, " | "))
+			row = row[:0]
 		}
-		toStderr(strings.Join(row, " | "))
 	}
 }
 
@@ -47,26 +64,286 @@ func checkErrors(errors []error) {
 	}
 }
 
-func execFile(path string, inputs []int, debug bool) {
+// stdin is shared between the debugger and interactive input
+// so that neither of them buffers input meant for the other.
+var stdin = bufio.NewReader(os.Stdin)
+
+func mustInputSource(args []string, interactive bool, path string, g lmc.Geometry) lmc.InputSource {
+	if interactive {
+		in := lmc.NewPromptInput(stdin, os.Stderr, "Input: ")
+		in.Max = g.Max()
+		return in
+	}
+	if path != "" {
+		in, err := lmc.OpenInputFile(path)
+		if err != nil {
+			toStderr(err)
+			os.Exit(1)
+		}
+		in.Max = g.Max()
+		return in
+	}
+	return lmc.NewSliceInput(mustInt(args, g))
+}
+
+var arithmetics = map[string]lmc.Arithmetic{
+	"wrap":     lmc.Wrap,
+	"saturate": lmc.Saturate,
+}
+
+// options shared by all of the modes that run code
+type runOptions struct {
+	dialect     *lmc.Dialect
+	arith       lmc.Arithmetic
+	geometry    lmc.Geometry
+	stackSize   int // 0 disables the stack extension
+	devices     []lmc.Device
+	strict      bool
+	detectLoops bool
+	selfMod     string        // "report", "forbid" or empty
+	uninit      string        // same as selfMod
+	cycles      int           // 0 for no limit
+	timeout     time.Duration // 0 for no timeout
+}
+
+// compile compiles the code using the dialect and geometry.
+func (o runOptions) compile(r io.Reader) (*lmc.Program, []error) {
+	return lmc.Assembler{
+		Dialect:   o.dialect,
+		Geometry:  o.geometry,
+		StackSize: o.stackSize,
+		Devices:   o.devices,
+	}.Compile(r)
+}
+
+// newMachine returns a machine for the program set up with
+// the options.
+func (o runOptions) newMachine(prog *lmc.Program) (*lmc.Machine, error) {
+	vm := lmc.NewMachine(prog)
+	if err := o.setup(vm); err != nil {
+		return nil, err
+	}
+	return vm, nil
+}
+
+// setup applies the options to the machine, attaching a fresh
+// copy of each device.
+func (o runOptions) setup(vm *lmc.Machine) error {
+	for _, d := range o.devices {
+		if err := vm.Attach(d.Clone()); err != nil {
+			return err
+		}
+	}
+	vm.Strict = o.strict
+	vm.Arithmetic = o.arith
+	if o.detectLoops {
+		vm.Observers = append(vm.Observers, lmc.NewLoopDetector())
+	}
+	if o.selfMod != "" {
+		vm.Observers = append(vm.Observers, lmc.NewSelfModDetector(o.selfMod == "forbid"))
+	}
+	if o.uninit != "" {
+		vm.Observers = append(vm.Observers, lmc.NewUninitDetector(o.uninit == "forbid"))
+	}
+	if o.cycles > 0 {
+		vm.Observers = append(vm.Observers, lmc.CycleLimit{Limit: o.cycles})
+	}
+	return nil
+}
+
+// run runs the machine until it halts or the timeout expires.
+func (o runOptions) run(vm *lmc.Machine) ([]int, error) {
+	ctx := context.Background()
+	if o.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.timeout)
+		defer cancel()
+	}
+	return vm.RunContext(ctx)
+}
+
+// mustMachine compiles the code at path and returns a machine
+// for it. If resume is given, the machine starts from the saved
+// snapshot instead, and the code is optional.
+func mustMachine(path string, resume string, opts runOptions) *lmc.Machine {
+	var prog *lmc.Program
+	if path != "" || resume == "" {
+		fp := mustOpen(path)
+		defer fp.Close()
+		var errors []error
+		prog, errors = opts.compile(fp)
+		checkErrors(errors)
+	}
+	if resume == "" {
+		vm, err := opts.newMachine(prog)
+		if err != nil {
+			toStderr(err)
+			os.Exit(1)
+		}
+		return vm
+	}
+	fp := mustOpen(resume)
+	defer fp.Close()
+	snapshot, err := lmc.ReadSnapshot(fp)
+	if err != nil {
+		toStderr(fmt.Sprintf("%s: %s", resume, err))
+		os.Exit(1)
+	}
+	vm, err := snapshot.Machine(prog)
+	if err != nil {
+		toStderr(fmt.Sprintf("%s: %s", resume, err))
+		os.Exit(1)
+	}
+	if prog == nil && snapshot.Dialect == "" {
+		vm.Dialect = opts.dialect
+	}
+	if err := opts.setup(vm); err != nil {
+		toStderr(err)
+		os.Exit(1)
+	}
+	return vm
+}
+
+// reportWarnings writes any self-modifying code and
+// uninitialized reads seen by the machine to stderr. Detectors
+// which forbid them have already stopped the machine with an
+// error.
+func reportWarnings(vm *lmc.Machine) {
+	for _, o := range vm.Observers {
+		switch d := o.(type) {
+		case *lmc.SelfModDetector:
+			if d.Forbid {
+				continue
+			}
+			for _, e := range d.Events {
+				toStderr("self-modifying code:", e)
+			}
+		case *lmc.UninitDetector:
+			if d.Forbid {
+				continue
+			}
+			for _, r := range d.Reads {
+				toStderr("warning:", r)
+			}
+		}
+	}
+}
+
+// reportDevices writes the state of any displays attached to
+// the machine to stderr.
+func reportDevices(vm *lmc.Machine) {
+	for _, d := range vm.Devices() {
+		if display, ok := d.(*lmc.Display); ok {
+			toStderr("display:", display)
+		}
+	}
+}
+
+func execFile(path string, resume string, in lmc.InputSource, debug bool, opts runOptions) {
+	ctx := mustMachine(path, resume, opts)
+	ctx.In = in
+	if debug {
+		newDebugger(ctx, stdin, os.Stdout).repl()
+		return
+	}
+	// outputs are written as soon as they are produced, so if
+	// we are stopped early the partial output is still shown
+	ctx.Out = lmc.NewWriterOutput(os.Stdout)
+	_, err := opts.run(ctx)
+	reportWarnings(ctx)
+	reportDevices(ctx)
+	if err != nil {
+		toStderr(err)
+		os.Exit(1)
+	}
+}
+
+// netFile runs the network described by the file at path,
+// writing a line per machine to stdout. The code of each
+// machine is relative to the network file.
+func netFile(path string, opts runOptions) {
 	fp := mustOpen(path)
 	defer fp.Close()
-	mailboxes, _, errors := compile(fp)
+	config, errors := lmc.ParseNetwork(fp, opts.geometry)
 	checkErrors(errors)
-	ctx := newContextFromSlice(mailboxes)
-	if debug {
-		printMailboxes(ctx)
+	net := &lmc.Network{}
+	for _, m := range config.Machines {
+		code := mustOpen(filepath.Join(filepath.Dir(path), m.Path))
+		prog, errors := opts.compile(code)
+		code.Close()
+		checkErrors(errors)
+		vm, err := opts.newMachine(prog)
+		if err == nil {
+			vm.Input = m.Input
+			err = net.Add(m.Name, vm)
+		}
+		if err != nil {
+			toStderr(fmt.Sprintf("%s: %s", m.Name, err))
+			os.Exit(1)
+		}
+	}
+	for _, l := range config.Links {
+		if err := net.Connect(l.From, l.To, l.Size); err != nil {
+			toStderr(err)
+			os.Exit(1)
+		}
+	}
+	ctx := context.Background()
+	if opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+		defer cancel()
+	}
+	err := net.Run(ctx)
+	failed := err != nil
+	for _, node := range net.Nodes {
+		state := "halted"
+		if node.Err != nil {
+			state = node.Err.Error()
+			failed = true
+		} else if wait := node.Blocked(); wait != "" {
+			state = "blocked on " + wait
+		} else if !node.VM.Halted {
+			state = "running"
+		}
+		fmt.Printf("%s: %d cycles, %s, output: %s\n", node.Name, node.VM.Cycles, state, lmc.FormatOutput(node.VM.Output, node.VM.Channels))
 	}
-	ctx.input = inputs
-	outputs, err := ctx.run()
 	if err != nil {
 		toStderr(err)
+	}
+	if failed {
 		os.Exit(1)
 	}
-	for _, out := range outputs {
-		fmt.Println(out)
+}
+
+func mustTraceWriter(format string) lmc.TraceWriter {
+	switch format {
+	case "json":
+		return lmc.NewJSONTraceWriter(os.Stdout)
+	case "csv":
+		return lmc.NewCSVTraceWriter(os.Stdout)
+	}
+	toStderr("unknown trace format:", format)
+	os.Exit(1)
+	return nil
+}
+
+// traceFile runs the code, writing a record of each step to
+// stdout and any output to stderr.
+func traceFile(path string, resume string, in lmc.InputSource, opts runOptions, format string) {
+	tw := mustTraceWriter(format)
+	ctx := mustMachine(path, resume, opts)
+	ctx.In = in
+	ctx.Out = lmc.NewWriterOutput(os.Stderr)
+	ctx.Observers = append(ctx.Observers, &lmc.Tracer{W: tw})
+	_, err := opts.run(ctx)
+	if e := tw.Flush(); e != nil && err == nil {
+		err = e
 	}
-	if debug {
-		printMailboxes(ctx)
+	reportWarnings(ctx)
+	if err != nil {
+		toStderr(err)
+		os.Exit(1)
 	}
 }
 
@@ -75,42 +352,129 @@ func main() {
 	workers := flag.Int("workers", 4, "no of workers to use")
 	batchMode := flag.Bool("batch", false, "batch process mode")
 	heatmap := flag.Bool("heatmap", false, "output heatmap")
+	trace := flag.Bool("trace", false, "output a trace of each step")
+	format := flag.String("format", "json", "trace format (json or csv)")
 	debug := flag.Bool("debug", false, "debug mode")
+	strict := flag.Bool("strict", false, "stop on undefined instructions")
+	interactive := flag.Bool("interactive", false, "prompt for each input")
+	inputFile := flag.String("input", "", "path to file of inputs")
+	detectLoops := flag.Bool("detect-loops", false, "stop on infinite loops")
+	cycles := flag.Int("cycles", 0, "maximum no of cycles to run for (0 for no limit)")
+	timeout := flag.Duration("timeout", 0, "maximum time to run for, e.g. 5s (0 for no limit)")
+	resume := flag.String("resume", "", "path to a snapshot to resume from")
+	dialect := flag.String("dialect", "og", "LMC dialect ("+strings.Join(lmc.DialectNames(), ", ")+")")
+	arith := flag.String("arith", "wrap", "what ADD and SUB do outside 0-999 (wrap or saturate)")
+	geometry := flag.String("geometry", "100x3", "no of mailboxes and digits per word, e.g. 1000x4")
+	stackSize := flag.Int("stack", 0, "no of mailboxes to reserve for CALL, RET, PUSH and POP (0 to disable)")
+	selfMod := flag.String("self-modifying", "", "report or forbid self-modifying code")
+	uninit := flag.String("uninitialized", "", "report or forbid reads of uninitialized mailboxes")
+	network := flag.Bool("network", false, "run the network of machines described by the file")
+	devices := flag.String("devices", "", "devices to attach, e.g. rng=42,clock,keyboard=KEYS,display=90:4")
 	flag.Parse()
+	d, err := lmc.LookupDialect(*dialect)
+	if err != nil {
+		toStderr(err)
+		os.Exit(1)
+	}
+	g, err := lmc.ParseGeometry(*geometry)
+	if err != nil {
+		toStderr(err)
+		os.Exit(1)
+	}
+	a, ok := arithmetics[*arith]
+	if !ok {
+		toStderr("unknown arithmetic:", *arith)
+		os.Exit(1)
+	}
+	if *selfMod != "" && *selfMod != "report" && *selfMod != "forbid" {
+		toStderr("unknown self-modifying rule:", *selfMod)
+		os.Exit(1)
+	}
+	if *uninit != "" && *uninit != "report" && *uninit != "forbid" {
+		toStderr("unknown uninitialized rule:", *uninit)
+		os.Exit(1)
+	}
+	opts := runOptions{
+		dialect:     d,
+		arith:       a,
+		geometry:    g,
+		stackSize:   *stackSize,
+		strict:      *strict,
+		detectLoops: *detectLoops,
+		selfMod:     *selfMod,
+		uninit:      *uninit,
+		cycles:      *cycles,
+		timeout:     *timeout,
+	}
+
+	if !*batchMode {
+		opts.devices = mustDevices(*devices, opts.geometry)
+	}
 
 	if *heatmap {
-		inputs := mustInt(flag.Args())
+		inputs := mustInputSource(flag.Args(), *interactive, *inputFile, opts.geometry)
 		fp := mustOpen(*filename)
-		vm, errors := newHeatmapVM(fp)
+		vm, errors := newHeatmapVM(fp, opts)
 		checkErrors(errors)
-		outputs, err := vm.run(inputs)
+		outputs, err := vm.run(inputs, opts)
+		// still show the partial output and heatmap if the
+		// program was stopped early
+		stderr := lmc.NewWriterOutput(os.Stderr)
+		for i, out := range outputs {
+			stderr.WriteChannel(out, vm.vm.Channels[i])
+		}
+		writeEntries(vm.format(), vm.vm.Geometry.AddrWidth(), os.Stdout)
 		if err != nil {
 			toStderr(err)
 			os.Exit(1)
 		}
-		for _, out := range outputs {
-			toStderr(fmt.Sprintf("%d", out))
-		}
-		writeEntries(vm.format(), os.Stdout)
+		return
+	}
+
+	if *network {
+		netFile(*filename, opts)
+		return
+	}
+
+	if *trace {
+		inputs := mustInputSource(flag.Args(), *interactive, *inputFile, opts.geometry)
+		traceFile(*filename, *resume, inputs, opts, *format)
 		return
 	}
 
 	if !(*batchMode) {
-		inputs := mustInt(flag.Args())
-		execFile(*filename, inputs, *debug)
+		inputs := mustInputSource(flag.Args(), *interactive, *inputFile, opts.geometry)
+		execFile(*filename, *resume, inputs, *debug, opts)
 		return
 	}
 
 	toStderr("Reading batch file:", *filename)
 	dirname := filepath.Dir(*filename)
 	fp := mustOpen(*filename)
-	cases, errors := parseBatch(fp)
+	batch, errors := lmc.ParseBatch(fp)
 	if len(errors) > 0 {
 		for _, e := range errors {
 			toStderr(" ", e)
 		}
 		os.Exit(1)
 	}
+	// settings pinned by the batch file win over the flags
+	if batch.Dialect != nil {
+		opts.dialect = batch.Dialect
+	}
+	if batch.Geometry != (lmc.Geometry{}) {
+		opts.geometry = batch.Geometry
+	}
+	if batch.StackSize > 0 {
+		opts.stackSize = batch.StackSize
+	}
+	if batch.SelfModifying != "" {
+		opts.selfMod = batch.SelfModifying
+	}
+	if batch.Uninitialized != "" {
+		opts.uninit = batch.Uninitialized
+	}
+	opts.devices = append(mustDevices(*devices, opts.geometry), batch.Devices...)
 	dir := mustOpen(dirname)
 	files, err := dir.Readdirnames(-1)
 	if err != nil {
@@ -123,7 +487,7 @@ func main() {
 		if filepath.Base(path) == filepath.Base(*filename) {
 			continue
 		}
-		code, used, errs := compile(mustOpen(path))
+		prog, errs := opts.compile(mustOpen(path))
 		toStderr("  Compiling:", file)
 		// failing to compile a single file is a non-fatal error
 		// so just continue trying to compile other files
@@ -131,7 +495,12 @@ func main() {
 			table.addErrors(path, errs)
 			continue
 		}
-		table.addRow(path, used, batch(*workers, code, cases))
+		vm, err := opts.newMachine(prog)
+		if err != nil {
+			table.addErrors(path, []error{err})
+			continue
+		}
+		table.addRow(path, prog.Size(), lmc.RunTestCases(*workers, vm, batch.Cases))
 	}
 	err = table.write(os.Stdout)
 	if err != nil {
@@ -0,0 +1,240 @@
+package main
+
+import "fmt"
+import "strconv"
+import "strings"
+import "unicode"
+import "github.com/eugene-eeo/yalmc/lmc"
+
+type evalFunc func(vm *lmc.Machine) int
+
+// Conditions are small expressions evaluated against the
+// machine after each step:
+//
+//	expr  = and { "||" and }
+//	and   = not { "&&" not }
+//	not   = "!" not | cmp
+//	cmp   = sum [ ("==" | "!=" | "<" | "<=" | ">" | ">=") sum ]
+//	sum   = atom { ("+" | "-") atom }
+//	atom  = number | "acc" | "pc" | "neg" | "out" | label
+//	      | "&" label | "[" expr "]" | "(" expr ")"
+//
+// A label evaluates to the contents of its mailbox, &label to
+// the mailbox itself, and [expr] to the contents of mailbox
+// expr. out is the value written by the last OUT step, or -1
+// if the last step was not an OUT. Comparisons and booleans
+// evaluate to 1 or 0, and any non-zero value is true.
+type condition struct {
+	text string
+	eval evalFunc
+}
+
+func (c *condition) test(vm *lmc.Machine) bool {
+	return c.eval(vm) != 0
+}
+
+func b2i(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+type condParser struct {
+	tokens []string
+	pos    int
+	labels map[string]int
+}
+
+var twoCharOps = map[string]bool{
+	"==": true, "!=": true, "<=": true, ">=": true, "&&": true, "||": true,
+}
+
+func tokenize(s string) ([]string, error) {
+	tokens := []string{}
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_':
+			j := i
+			for j < len(s) && (unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j])) || s[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		case i+1 < len(s) && twoCharOps[s[i:i+2]]:
+			tokens = append(tokens, s[i:i+2])
+			i += 2
+		case strings.ContainsRune("<>!&+-()[]", c):
+			tokens = append(tokens, string(c))
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected character '%c'", c)
+		}
+	}
+	return tokens, nil
+}
+
+func (p *condParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *condParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *condParser) expect(t string) error {
+	if got := p.next(); got != t {
+		return fmt.Errorf("expected '%s' but got '%s'", t, got)
+	}
+	return nil
+}
+
+func (p *condParser) expr() (evalFunc, error) {
+	lhs, err := p.and()
+	for err == nil && p.peek() == "||" {
+		p.next()
+		var rhs evalFunc
+		rhs, err = p.and()
+		l, r := lhs, rhs
+		lhs = func(vm *lmc.Machine) int { return b2i(l(vm) != 0 || r(vm) != 0) }
+	}
+	return lhs, err
+}
+
+func (p *condParser) and() (evalFunc, error) {
+	lhs, err := p.not()
+	for err == nil && p.peek() == "&&" {
+		p.next()
+		var rhs evalFunc
+		rhs, err = p.not()
+		l, r := lhs, rhs
+		lhs = func(vm *lmc.Machine) int { return b2i(l(vm) != 0 && r(vm) != 0) }
+	}
+	return lhs, err
+}
+
+func (p *condParser) not() (evalFunc, error) {
+	if p.peek() == "!" {
+		p.next()
+		f, err := p.not()
+		return func(vm *lmc.Machine) int { return b2i(f(vm) == 0) }, err
+	}
+	return p.cmp()
+}
+
+var comparisons = map[string]func(a, b int) bool{
+	"==": func(a, b int) bool { return a == b },
+	"!=": func(a, b int) bool { return a != b },
+	"<":  func(a, b int) bool { return a < b },
+	"<=": func(a, b int) bool { return a <= b },
+	">":  func(a, b int) bool { return a > b },
+	">=": func(a, b int) bool { return a >= b },
+}
+
+func (p *condParser) cmp() (evalFunc, error) {
+	lhs, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := comparisons[p.peek()]
+	if !ok {
+		return lhs, nil
+	}
+	p.next()
+	rhs, err := p.sum()
+	return func(vm *lmc.Machine) int { return b2i(op(lhs(vm), rhs(vm))) }, err
+}
+
+func (p *condParser) sum() (evalFunc, error) {
+	lhs, err := p.atom()
+	for err == nil && (p.peek() == "+" || p.peek() == "-") {
+		sign := 1
+		if p.next() == "-" {
+			sign = -1
+		}
+		var rhs evalFunc
+		rhs, err = p.atom()
+		l, r := lhs, rhs
+		lhs = func(vm *lmc.Machine) int { return l(vm) + sign*r(vm) }
+	}
+	return lhs, err
+}
+
+func (p *condParser) atom() (evalFunc, error) {
+	t := p.next()
+	switch t {
+	case "":
+		return nil, fmt.Errorf("unexpected end of condition")
+	case "acc":
+		return func(vm *lmc.Machine) int { return vm.Acc }, nil
+	case "pc":
+		return func(vm *lmc.Machine) int { return vm.PC }, nil
+	case "neg":
+		return func(vm *lmc.Machine) int { return b2i(vm.Neg) }, nil
+	case "out":
+		return func(vm *lmc.Machine) int {
+			if !vm.Last.Out {
+				return -1
+			}
+			return vm.Last.Value
+		}, nil
+	case "(":
+		f, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		return f, p.expect(")")
+	case "[":
+		f, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		return func(vm *lmc.Machine) int {
+			mailbox := f(vm)
+			if mailbox < 0 || mailbox >= len(vm.Mem) {
+				return 0
+			}
+			return vm.Mem[mailbox]
+		}, p.expect("]")
+	case "&":
+		label := p.next()
+		mailbox, ok := p.labels[label]
+		if !ok {
+			return nil, fmt.Errorf("unknown label '%s'", label)
+		}
+		return func(vm *lmc.Machine) int { return mailbox }, nil
+	}
+	if n, err := strconv.Atoi(t); err == nil {
+		return func(vm *lmc.Machine) int { return n }, nil
+	}
+	if mailbox, ok := p.labels[t]; ok {
+		return func(vm *lmc.Machine) int { return vm.Mem[mailbox] }, nil
+	}
+	return nil, fmt.Errorf("unknown label '%s'", t)
+}
+
+// parseCondition compiles a condition, resolving labels with
+// the given label table.
+func parseCondition(s string, labels map[string]int) (*condition, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &condParser{tokens: tokens, labels: labels}
+	f, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("unexpected '%s'", p.peek())
+	}
+	return &condition{strings.TrimSpace(s), f}, nil
+}
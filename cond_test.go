@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+import "github.com/stretchr/testify/assert"
+import "github.com/eugene-eeo/yalmc/lmc"
+
+type conditionTest struct {
+	text  string
+	value int
+	err   bool
+}
+
+func TestCondition(t *testing.T) {
+	vm := lmc.NewMachine(&lmc.Program{})
+	vm.Acc = 600
+	vm.PC = 3
+	vm.Neg = true
+	vm.Mem[5] = 42
+	vm.Mem[42] = 7
+	vm.Last = lmc.Effect{Out: true, Value: 600}
+	labels := map[string]int{"x": 5}
+	tests := []conditionTest{
+		conditionTest{"acc > 500", 1, false},
+		conditionTest{"acc>500&&!neg", 0, false},
+		conditionTest{"neg", 1, false},
+		conditionTest{"x == 42", 1, false},
+		conditionTest{"&x", 5, false},
+		conditionTest{"[x] + 1", 8, false},
+		conditionTest{"[&x + 37]", 7, false},
+		conditionTest{"pc - 1 - 1", 1, false},
+		conditionTest{"out == 600 || acc < 0", 1, false},
+		conditionTest{"(acc <= 600) && (pc != 3)", 0, false},
+		conditionTest{"y > 1", 0, true},
+		conditionTest{"acc >", 0, true},
+		conditionTest{"acc = 1", 0, true},
+		conditionTest{"(acc", 0, true},
+		conditionTest{"acc acc", 0, true},
+	}
+	for _, c := range tests {
+		cond, err := parseCondition(c.text, labels)
+		assert.Equal(t, err != nil, c.err, c.text)
+		if err == nil {
+			assert.Equal(t, cond.eval(vm), c.value, c.text)
+		}
+	}
+}
@@ -0,0 +1,509 @@
+package main
+
+import "io"
+import "os"
+import "fmt"
+import "bufio"
+import "strconv"
+import "strings"
+import "github.com/eugene-eeo/yalmc/lmc"
+
+const debuggerHelp = `commands:
+  s, step [n]           execute n instructions (default 1)
+  n, next               run until the next mailbox is reached
+  c, continue           run until a breakpoint is hit or the program halts
+  bs, back [n]          step back n instructions (default 1)
+  rc, reverse-continue  step back until a breakpoint is hit, ignoring
+                        watchpoints
+  who <addr>            show which instruction last wrote a label/mailbox
+  b, break <addr>       set a breakpoint at a label or mailbox
+  b, break <addr> if <cond>
+                        break at a label or mailbox when cond is true
+  b, break if <cond>    break whenever cond is true, e.g. 'acc > 500'
+  watch <addr>          break when a label/mailbox is written
+  rwatch <addr>         break when a label/mailbox is read
+  awatch <addr>         break when a label/mailbox is read or written
+  d, delete <n>         delete breakpoint n
+  info                  list breakpoints
+  p, print <x>          print acc, pc, neg, sp, or a label/mailbox
+  set <addr> <value>    set a label/mailbox to a value
+  l, list               show the current source line
+  mem                   show all mailboxes
+  stack                 show the stack, from the top down
+  save <file>           save a snapshot of the machine, see -resume
+  h, help               show this help
+  q, quit               exit the debugger
+an empty line repeats the last command.`
+
+// maximum number of steps that can be undone in the debugger
+const debuggerHistory = 100000
+
+const (
+	breakAt = iota
+	breakIf
+	watchRead
+	watchWrite
+	watchAccess
+)
+
+type breakpoint struct {
+	id      int
+	kind    int
+	mailbox int
+	where   string     // description of the mailbox
+	cond    *condition // may be nil for breakAt
+}
+
+func (b *breakpoint) String() string {
+	switch b.kind {
+	case breakAt:
+		if b.cond != nil {
+			return fmt.Sprintf("breakpoint %d at %s if %s", b.id, b.where, b.cond.text)
+		}
+		return fmt.Sprintf("breakpoint %d at %s", b.id, b.where)
+	case breakIf:
+		return fmt.Sprintf("breakpoint %d if %s", b.id, b.cond.text)
+	case watchRead:
+		return fmt.Sprintf("watchpoint %d on reads of %s", b.id, b.where)
+	case watchWrite:
+		return fmt.Sprintf("watchpoint %d on writes to %s", b.id, b.where)
+	}
+	return fmt.Sprintf("watchpoint %d on accesses to %s", b.id, b.where)
+}
+
+// hit reports whether the breakpoint fires after a step; when
+// reverse is set the effects of the step are not available so
+// only breakpoints which depend on the state are checked.
+func (b *breakpoint) hit(vm *lmc.Machine, reverse bool) bool {
+	last := vm.Last
+	switch b.kind {
+	case breakAt:
+		return vm.PC == b.mailbox && (b.cond == nil || b.cond.test(vm))
+	case breakIf:
+		return b.cond.test(vm)
+	}
+	if reverse {
+		return false
+	}
+	read := last.Read == b.mailbox
+	written := last.Write == b.mailbox
+	switch b.kind {
+	case watchRead:
+		return read
+	case watchWrite:
+		return written
+	}
+	return read || written
+}
+
+// debugger is a line oriented debugger for a single machine.
+type debugger struct {
+	vm     *lmc.Machine
+	prog   *lmc.Program
+	points []*breakpoint
+	nextID int
+	r      *bufio.Reader
+	w      io.Writer
+	done   bool
+}
+
+type outputPrinter struct {
+	w io.Writer
+}
+
+func (o outputPrinter) Write(n int) error {
+	return o.WriteChannel(n, lmc.Numeric)
+}
+
+func (o outputPrinter) WriteChannel(n int, ch lmc.Channel) error {
+	if ch == lmc.Char {
+		_, err := fmt.Fprintf(o.w, "output: %q\n", rune(n))
+		return err
+	}
+	_, err := fmt.Fprintf(o.w, "output: %d\n", n)
+	return err
+}
+
+func newDebugger(vm *lmc.Machine, r *bufio.Reader, w io.Writer) *debugger {
+	vm.Out = outputPrinter{w}
+	vm.HistoryLimit = debuggerHistory
+	return &debugger{
+		vm:   vm,
+		prog: vm.Program(),
+		r:    r,
+		w:    w,
+	}
+}
+
+func (d *debugger) printf(format string, a ...interface{}) {
+	fmt.Fprintf(d.w, format, a...)
+}
+
+// resolve converts a label or a mailbox number to a mailbox.
+func (d *debugger) resolve(s string) (int, error) {
+	if d.prog != nil {
+		if mailbox, ok := d.prog.Labels[s]; ok {
+			return mailbox, nil
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n >= len(d.vm.Mem) {
+		return 0, fmt.Errorf("unknown label or mailbox '%s'", s)
+	}
+	return n, nil
+}
+
+// describe returns the label and mailbox number of a mailbox.
+func (d *debugger) describe(mailbox int) string {
+	if d.prog != nil {
+		if line := d.prog.LineAt(mailbox); line != nil && line.Label != "" {
+			return fmt.Sprintf("%s (mailbox %0*d)", line.Label, d.vm.Geometry.AddrWidth(), mailbox)
+		}
+	}
+	return fmt.Sprintf("mailbox %0*d", d.vm.Geometry.AddrWidth(), mailbox)
+}
+
+func (d *debugger) list() {
+	pc := d.vm.PC
+	if pc >= len(d.vm.Mem) {
+		d.printf("=> mailbox %0*d\n", d.vm.Geometry.AddrWidth(), pc)
+		return
+	}
+	if d.prog != nil {
+		if line := d.prog.LineAt(pc); line != nil {
+			d.printf("=> mailbox %0*d, line %d: %s\n", d.vm.Geometry.AddrWidth(), pc, line.LineNo, strings.TrimSpace(line.Text))
+			return
+		}
+	}
+	instr := d.vm.Mem[pc]
+	d.printf("=> mailbox %0*d: %0*d (%s)\n", d.vm.Geometry.AddrWidth(), pc, d.vm.Geometry.Digits, instr, d.vm.Mnemonic(instr))
+}
+
+// step executes a single instruction, returning false if the
+// machine cannot continue.
+func (d *debugger) step() bool {
+	if d.vm.Halted {
+		d.printf("program has halted\n")
+		return false
+	}
+	err := d.vm.Step()
+	if err != nil {
+		d.printf("error: %s\n", err)
+		return false
+	}
+	if d.vm.Halted {
+		d.printf("program halted after %d cycles\n", d.vm.Cycles)
+		return false
+	}
+	return true
+}
+
+// checkBreakpoints prints and returns true if any of the
+// breakpoints have been hit.
+func (d *debugger) checkBreakpoints(reverse bool) bool {
+	hit := false
+	for _, b := range d.points {
+		if b.hit(d.vm, reverse) {
+			d.printf("%s\n", b)
+			hit = true
+		}
+	}
+	return hit
+}
+
+// runUntil steps until stop returns true, a breakpoint is
+// hit, or the machine cannot continue.
+func (d *debugger) runUntil(stop func() bool) {
+	for d.step() {
+		if d.checkBreakpoints(false) || stop() {
+			break
+		}
+	}
+	d.list()
+}
+
+func (d *debugger) labels() map[string]int {
+	if d.prog == nil {
+		return map[string]int{}
+	}
+	return d.prog.Labels
+}
+
+func (d *debugger) addBreakpoint(b *breakpoint) {
+	d.nextID++
+	b.id = d.nextID
+	d.points = append(d.points, b)
+	d.printf("%s\n", b)
+}
+
+// breakpoint parses the arguments to break, which are one of:
+// <addr>, <addr> if <cond>, or if <cond>.
+func (d *debugger) breakpoint(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: break <label|mailbox> [if <cond>] | break if <cond>")
+	}
+	if args[0] == "if" {
+		cond, err := parseCondition(strings.Join(args[1:], " "), d.labels())
+		if err != nil {
+			return err
+		}
+		d.addBreakpoint(&breakpoint{kind: breakIf, cond: cond})
+		return nil
+	}
+	mailbox, err := d.resolve(args[0])
+	if err != nil {
+		return err
+	}
+	b := &breakpoint{kind: breakAt, mailbox: mailbox, where: d.describe(mailbox)}
+	if len(args) > 1 {
+		if args[1] != "if" {
+			return fmt.Errorf("expected 'if' but got '%s'", args[1])
+		}
+		b.cond, err = parseCondition(strings.Join(args[2:], " "), d.labels())
+		if err != nil {
+			return err
+		}
+	}
+	d.addBreakpoint(b)
+	return nil
+}
+
+func (d *debugger) deleteBreakpoint(id string) error {
+	for i, b := range d.points {
+		if strconv.Itoa(b.id) == id {
+			d.points = append(d.points[:i], d.points[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("no breakpoint '%s'", id)
+}
+
+// back undoes a single step, returning false if there is
+// nothing left to undo.
+func (d *debugger) back() bool {
+	if d.vm.StepBack() != nil {
+		d.printf("at the start of history\n")
+		return false
+	}
+	return true
+}
+
+func (d *debugger) who(mailbox int) {
+	pc, cycle, ok := d.vm.LastWrite(mailbox)
+	if !ok {
+		d.printf("%s has not been written to\n", d.describe(mailbox))
+		return
+	}
+	where := fmt.Sprintf("mailbox %0*d", d.vm.Geometry.AddrWidth(), pc)
+	if d.prog != nil {
+		if line := d.prog.LineAt(pc); line != nil {
+			where = fmt.Sprintf("mailbox %0*d, line %d", d.vm.Geometry.AddrWidth(), pc, line.LineNo)
+		}
+	}
+	d.printf("%s was last written by %s at cycle %d\n", d.describe(mailbox), where, cycle)
+}
+
+func (d *debugger) print(what string) error {
+	switch what {
+	case "acc":
+		d.printf("acc = %d\n", d.vm.Acc)
+	case "pc":
+		d.printf("pc = %d\n", d.vm.PC)
+	case "neg":
+		d.printf("neg = %t\n", d.vm.Neg)
+	case "sp":
+		if d.vm.StackSize == 0 {
+			return fmt.Errorf("the stack extension is not enabled")
+		}
+		d.printf("sp = %d\n", d.vm.SP)
+	default:
+		mailbox, err := d.resolve(what)
+		if err != nil {
+			return err
+		}
+		d.printf("%s = %0*d\n", d.describe(mailbox), d.vm.Geometry.Digits, d.vm.Mem[mailbox])
+	}
+	return nil
+}
+
+func (d *debugger) info() {
+	if len(d.points) == 0 {
+		d.printf("no breakpoints\n")
+		return
+	}
+	for _, b := range d.points {
+		d.printf("%s\n", b)
+	}
+}
+
+// stack prints the values on the stack.
+func (d *debugger) stack() error {
+	if d.vm.StackSize == 0 {
+		return fmt.Errorf("the stack extension is not enabled")
+	}
+	values := d.vm.Stack()
+	if len(values) == 0 {
+		d.printf("stack is empty\n")
+	}
+	for i, n := range values {
+		d.printf("%s = %0*d\n", d.describe(d.vm.SP+i), d.vm.Geometry.Digits, n)
+	}
+	return nil
+}
+
+// save writes a snapshot of the machine to the given file.
+func (d *debugger) save(path string) error {
+	fp, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = lmc.WriteSnapshot(fp, d.vm.Snapshot())
+	if e := fp.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		d.printf("saved snapshot to %s\n", path)
+	}
+	return err
+}
+
+// count parses an optional repeat count, defaulting to 1.
+func count(args []string) (int, error) {
+	if len(args) == 0 {
+		return 1, nil
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid count '%s'", args[0])
+	}
+	return n, nil
+}
+
+func (d *debugger) exec(cmd string, args []string) error {
+	switch cmd {
+	case "s", "step":
+		n, err := count(args)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < n && d.step(); i++ {
+		}
+		d.list()
+	case "bs", "back":
+		n, err := count(args)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < n && d.back(); i++ {
+		}
+		d.list()
+	case "rc", "reverse-continue":
+		for d.back() {
+			if d.checkBreakpoints(true) {
+				break
+			}
+		}
+		d.list()
+	case "who":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: who <label|mailbox>")
+		}
+		mailbox, err := d.resolve(args[0])
+		if err != nil {
+			return err
+		}
+		d.who(mailbox)
+	case "n", "next":
+		target := d.vm.PC + 1
+		d.runUntil(func() bool { return d.vm.PC == target })
+	case "c", "continue":
+		d.runUntil(func() bool { return false })
+	case "b", "break":
+		return d.breakpoint(args)
+	case "watch", "rwatch", "awatch":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: %s <label|mailbox>", cmd)
+		}
+		mailbox, err := d.resolve(args[0])
+		if err != nil {
+			return err
+		}
+		kind := map[string]int{"watch": watchWrite, "rwatch": watchRead, "awatch": watchAccess}[cmd]
+		d.addBreakpoint(&breakpoint{kind: kind, mailbox: mailbox, where: d.describe(mailbox)})
+	case "d", "delete":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: delete <n>")
+		}
+		return d.deleteBreakpoint(args[0])
+	case "info":
+		d.info()
+	case "p", "print":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: print <acc|pc|neg|sp|label|mailbox>")
+		}
+		return d.print(args[0])
+	case "set":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: set <label|mailbox> <value>")
+		}
+		mailbox, err := d.resolve(args[0])
+		if err != nil {
+			return err
+		}
+		value, err := strconv.Atoi(args[1])
+		if err != nil || value < 0 || value > d.vm.Geometry.Max() {
+			return fmt.Errorf("invalid value '%s'", args[1])
+		}
+		if err := d.vm.Set(mailbox, value); err != nil {
+			return err
+		}
+		d.printf("%s = %0*d\n", d.describe(mailbox), d.vm.Geometry.Digits, value)
+	case "l", "list":
+		d.list()
+	case "mem":
+		printMailboxes(d.w, d.vm)
+	case "stack":
+		return d.stack()
+	case "save":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: save <file>")
+		}
+		return d.save(args[0])
+	case "h", "help":
+		d.printf("%s\n", debuggerHelp)
+	case "q", "quit":
+		d.done = true
+	default:
+		return fmt.Errorf("unknown command '%s', try 'help'", cmd)
+	}
+	return nil
+}
+
+// repl reads and executes commands until the user quits or
+// there is no more input.
+func (d *debugger) repl() {
+	last := ""
+	d.list()
+	for !d.done {
+		d.printf("(yalmc) ")
+		s, err := d.r.ReadString('\n')
+		s = strings.TrimSpace(s)
+		if s == "" {
+			if err != nil {
+				break
+			}
+			s = last
+		}
+		last = s
+		fields := strings.Fields(s)
+		if len(fields) == 0 {
+			continue
+		}
+		if e := d.exec(fields[0], fields[1:]); e != nil {
+			d.printf("%s\n", e)
+		}
+		if err != nil {
+			break
+		}
+	}
+}
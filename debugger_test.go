@@ -0,0 +1,189 @@
+package main
+
+import "bytes"
+import "bufio"
+import "strings"
+import "testing"
+import "github.com/stretchr/testify/assert"
+import "github.com/eugene-eeo/yalmc/lmc"
+
+func runDebugger(t *testing.T, code string, inputs []int, script string) string {
+	prog, errs := lmc.Compile(strings.NewReader(code))
+	assert.Equal(t, len(errs), 0, "No errors in compilation")
+	vm := lmc.NewMachine(prog)
+	vm.In = lmc.NewSliceInput(inputs)
+	w := &bytes.Buffer{}
+	newDebugger(vm, bufio.NewReader(strings.NewReader(script)), w).repl()
+	return w.String()
+}
+
+func TestDebugger(t *testing.T) {
+	out := runDebugger(t, `
+	LDA	zero
+loop	ADD	one
+	OUT
+	BR	loop
+zero	DAT
+one	DAT	1`, nil, strings.Join([]string{
+		"break loop",
+		"continue",
+		"",
+		"print acc",
+		"set one 5",
+		"print one",
+		"step 2",
+		"print 7",
+		"quit",
+	}, "\n"))
+	assert.Equal(t, out, strings.Join([]string{
+		"=> mailbox 00, line 2: LDA\tzero",
+		"(yalmc) breakpoint 1 at loop (mailbox 01)",
+		"(yalmc) breakpoint 1 at loop (mailbox 01)",
+		"=> mailbox 01, line 3: loop\tADD\tone",
+		"(yalmc) output: 1",
+		"breakpoint 1 at loop (mailbox 01)",
+		"=> mailbox 01, line 3: loop\tADD\tone",
+		"(yalmc) acc = 1",
+		"(yalmc) one (mailbox 05) = 005",
+		"(yalmc) one (mailbox 05) = 005",
+		"(yalmc) output: 6",
+		"=> mailbox 03, line 5: BR\tloop",
+		"(yalmc) mailbox 07 = 000",
+		"(yalmc) ",
+	}, "\n"))
+}
+
+func TestDebuggerNext(t *testing.T) {
+	out := runDebugger(t, `
+	IN
+loop	SUB	one
+	BRP	loop
+	HLT
+one	DAT	1`, []int{3}, "s\nn\nn\nn\nc\n")
+	assert.Equal(t, out, strings.Join([]string{
+		"=> mailbox 00, line 2: IN",
+		"(yalmc) => mailbox 01, line 3: loop\tSUB\tone",
+		"(yalmc) => mailbox 02, line 4: BRP\tloop",
+		"(yalmc) => mailbox 03, line 5: HLT",
+		"(yalmc) program halted after 10 cycles",
+		"=> mailbox 04, line 6: one\tDAT\t1",
+		"(yalmc) program has halted",
+		"=> mailbox 04, line 6: one\tDAT\t1",
+		"(yalmc) ",
+	}, "\n"))
+}
+
+func TestDebuggerBack(t *testing.T) {
+	out := runDebugger(t, `
+	IN
+loop	STO	x
+	ADD	x
+	BRZ	loop
+	HLT
+x	DAT`, []int{2}, "b loop\nc\nc\nwho x\nbs 2\nprint acc\nrc\nwho x\nquit\n")
+	assert.Equal(t, out, strings.Join([]string{
+		"=> mailbox 00, line 2: IN",
+		"(yalmc) breakpoint 1 at loop (mailbox 01)",
+		"(yalmc) breakpoint 1 at loop (mailbox 01)",
+		"=> mailbox 01, line 3: loop\tSTO\tx",
+		"(yalmc) program halted after 5 cycles",
+		"=> mailbox 05, line 7: x\tDAT",
+		"(yalmc) x (mailbox 05) was last written by mailbox 01, line 3 at cycle 2",
+		"(yalmc) => mailbox 03, line 5: BRZ\tloop",
+		"(yalmc) acc = 4",
+		"(yalmc) breakpoint 1 at loop (mailbox 01)",
+		"=> mailbox 01, line 3: loop\tSTO\tx",
+		"(yalmc) x (mailbox 05) has not been written to",
+		"(yalmc) ",
+	}, "\n"))
+}
+
+func TestDebuggerSet(t *testing.T) {
+	out := runDebugger(t, `
+	LDA	x
+	OUT
+	HLT
+x	DAT	1`, nil, "set x 5\nprint x\nback\nprint x\nquit\n")
+	assert.Equal(t, out, strings.Join([]string{
+		"=> mailbox 00, line 2: LDA\tx",
+		"(yalmc) x (mailbox 03) = 005",
+		"(yalmc) x (mailbox 03) = 005",
+		"(yalmc) => mailbox 00, line 2: LDA\tx",
+		"(yalmc) x (mailbox 03) = 001",
+		"(yalmc) ",
+	}, "\n"))
+}
+
+func TestDebuggerWatchpoints(t *testing.T) {
+	out := runDebugger(t, `
+loop	LDA	x
+	ADD	one
+	STO	x
+	OUT
+	BR	loop
+x	DAT
+one	DAT	1`, nil, strings.Join([]string{
+		"watch x",
+		"c",
+		"print x",
+		"d 1",
+		"b if out == 3",
+		"c",
+		"b loop if x > 4",
+		"c",
+		"rwatch one",
+		"c",
+		"info",
+		"q",
+	}, "\n"))
+	assert.Equal(t, out, strings.Join([]string{
+		"=> mailbox 00, line 2: loop\tLDA\tx",
+		"(yalmc) watchpoint 1 on writes to x (mailbox 05)",
+		"(yalmc) watchpoint 1 on writes to x (mailbox 05)",
+		"=> mailbox 03, line 5: OUT",
+		"(yalmc) x (mailbox 05) = 001",
+		"(yalmc) (yalmc) breakpoint 2 if out == 3",
+		"(yalmc) output: 1",
+		"output: 2",
+		"output: 3",
+		"breakpoint 2 if out == 3",
+		"=> mailbox 04, line 6: BR\tloop",
+		"(yalmc) breakpoint 3 at loop (mailbox 00) if x > 4",
+		"(yalmc) output: 4",
+		"output: 5",
+		"breakpoint 3 at loop (mailbox 00) if x > 4",
+		"=> mailbox 00, line 2: loop\tLDA\tx",
+		"(yalmc) watchpoint 4 on reads of one (mailbox 06)",
+		"(yalmc) watchpoint 4 on reads of one (mailbox 06)",
+		"=> mailbox 02, line 4: STO\tx",
+		"(yalmc) breakpoint 2 if out == 3",
+		"breakpoint 3 at loop (mailbox 00) if x > 4",
+		"watchpoint 4 on reads of one (mailbox 06)",
+		"(yalmc) ",
+	}, "\n"))
+}
+
+func TestDebuggerStack(t *testing.T) {
+	prog, errs := lmc.Assembler{StackSize: 3}.Compile(strings.NewReader(`
+	CALL	sub
+	HLT
+sub	LDA	five
+	PUSH
+	POP
+	RET
+five	DAT	5`))
+	assert.Equal(t, len(errs), 0, "No errors in compilation")
+	vm := lmc.NewMachine(prog)
+	w := &bytes.Buffer{}
+	script := "stack\nstep 3\nstack\nprint sp\nquit\n"
+	newDebugger(vm, bufio.NewReader(strings.NewReader(script)), w).repl()
+	assert.Equal(t, w.String(), strings.Join([]string{
+		"=> mailbox 00, line 2: CALL\tsub",
+		"(yalmc) stack is empty",
+		"(yalmc) => mailbox 04, line 6: POP",
+		"(yalmc) mailbox 98 = 005",
+		"mailbox 99 = 001",
+		"(yalmc) sp = 98",
+		"(yalmc) ",
+	}, "\n"))
+}
@@ -2,6 +2,7 @@ package main
 
 import "io"
 import "fmt"
+import "github.com/eugene-eeo/yalmc/lmc"
 
 type entry struct {
 	mailbox int
@@ -20,62 +21,54 @@ func maxCount(entries []entry) int {
 }
 
 type heatmapVM struct {
-	vm      *context
-	code    []int
-	lines   []*Line
-	heatmap map[int]int
+	vm      *lmc.Machine
+	prog    *lmc.Program
+	heatmap *lmc.Heatmap
 }
 
-func newHeatmapVM(r io.Reader) (*heatmapVM, []error) {
-	lines, errors := parse(r)
+func newHeatmapVM(r io.Reader, opts runOptions) (*heatmapVM, []error) {
+	prog, errors := opts.compile(r)
 	if len(errors) != 0 {
 		return nil, errors
 	}
-	code, err := linesToInt(lines)
+	vm, err := opts.newMachine(prog)
 	if err != nil {
 		return nil, []error{err}
 	}
+	heatmap := lmc.NewHeatmap()
+	vm.Observers = append(vm.Observers, heatmap)
 	return &heatmapVM{
-		vm:      newContextFromSlice(code),
-		code:    code,
-		lines:   lines,
-		heatmap: map[int]int{},
+		vm:      vm,
+		prog:    prog,
+		heatmap: heatmap,
 	}, nil
 }
 
-func (h *heatmapVM) run(input []int) (output []int, err error) {
-	vm := h.vm
-	heatmap := h.heatmap
-	vm.input = input
-	for !vm.halted {
-		heatmap[vm.pc]++
-		err = vm.fetchExecute()
-		if err != nil {
-			break
-		}
-	}
-	output = vm.output
-	return
+func (h *heatmapVM) run(input lmc.InputSource, opts runOptions) (output []int, err error) {
+	h.vm.In = input
+	return opts.run(h.vm)
 }
 
 func (h *heatmapVM) format() []entry {
-	entries := make([]entry, 100)
+	entries := make([]entry, len(h.vm.Mem))
 	for i, _ := range entries {
-		count, ok := h.heatmap[i]
+		count, ok := h.heatmap.Counts[i]
 		text := ""
 		// first check if the mailbox is a line of code
-		if len(h.lines) > i {
-			text = h.lines[i].text
+		if line := h.prog.LineAt(i); line != nil {
+			text = line.Text
 		} else if ok {
 			// else check that we have executed this mailbox
-			text = fmt.Sprintf("%03d", h.vm.mem[i])
+			text = fmt.Sprintf("%0*d", h.vm.Geometry.Digits, h.vm.Mem[i])
 		}
 		entries[i] = entry{i, text, count}
 	}
 	return entries
 }
 
-func writeEntries(entries []entry, w io.Writer) error {
+// writeEntries writes the heatmap as HTML, with mailbox numbers
+// padded to width digits.
+func writeEntries(entries []entry, width int, w io.Writer) error {
 	_, err := w.Write([]byte(`
 	<style>
 	table  { border-collapse: collapse; }
@@ -93,10 +86,10 @@ func writeEntries(entries []entry, w io.Writer) error {
 		r := int(255 * (2 * e.count / max))
 		g := int(255 * (2 * (1 - e.count/max)))
 		s := fmt.Sprintf(
-			"<tr><td style='background-color: rgba(%d, %d, 0, 0.35)' class='count'>%d</td><td>%02d</td><td><pre>%s</pre></td></tr>",
+			"<tr><td style='background-color: rgba(%d, %d, 0, 0.35)' class='count'>%d</td><td>%0*d</td><td><pre>%s</pre></td></tr>",
 			r, g,
 			e.count,
-			e.mailbox,
+			width, e.mailbox,
 			e.text,
 		)
 		_, err := w.Write([]byte(s))
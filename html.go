@@ -5,6 +5,8 @@ import "strconv"
 import "path/filepath"
 import "fmt"
 import "io"
+import "html"
+import "github.com/eugene-eeo/yalmc/lmc"
 
 const tableFrontmatter string = `
 <style>
@@ -22,6 +24,9 @@ td,th { padding: 0 0.5em; border: 1px solid #000; }
 	<th>Output</th>
 	<th>Max Cycles</th>
 	<th>Cycles</th>
+	<th>Status</th>
+	<th>Error</th>
+	<th>Notes</th>
 </tr>
 `
 
@@ -33,6 +38,9 @@ func isliceToString(a []int) string {
 	return strings.Join(b, ", ")
 }
 
+// maximum number of device events shown for a test case
+const maxDeviceNotes = 20
+
 type table struct {
 	fragments []string
 }
@@ -47,13 +55,13 @@ func (t *table) addErrors(path string, errors []error) {
 		errorStrings = append(errorStrings, err.Error())
 	}
 	t.fragments = append(t.fragments, fmt.Sprintf(
-		"<tr><th>%s</th><td>-</td><td colspan=6><pre>%s</pre></td></tr>",
+		"<tr><th>%s</th><td>-</td><td colspan=9><pre>%s</pre></td></tr>",
 		filepath.Base(path),
 		strings.Join(errorStrings, "\n"),
 	))
 }
 
-func (t *table) addRow(path string, mailboxes int, results []testResult) {
+func (t *table) addRow(path string, mailboxes int, results []lmc.TestResult) {
 	trs := []string{fmt.Sprintf(
 		"<tr><th rowspan='%d'>%s</th><td rowspan='%d'>%d</td></tr>",
 		len(results)+1,
@@ -63,18 +71,39 @@ func (t *table) addRow(path string, mailboxes int, results []testResult) {
 	)}
 	for _, res := range results {
 		color := "#ffffff"
-		if res.failed() {
+		if res.Failed() {
 			color = "#ff6666"
 		}
+		errText := ""
+		if res.Err != nil {
+			errText = res.Err.Error()
+		}
+		notes := []string{}
+		for _, e := range res.SelfModifying {
+			notes = append(notes, html.EscapeString(e.String()))
+		}
+		for _, r := range res.UninitReads {
+			notes = append(notes, html.EscapeString(r.String()))
+		}
+		for i, e := range res.Devices {
+			if i == maxDeviceNotes {
+				notes = append(notes, fmt.Sprintf("... and %d more device events", len(res.Devices)-i))
+				break
+			}
+			notes = append(notes, html.EscapeString(e.String()))
+		}
 		trs = append(trs, fmt.Sprintf(
-			"<tr style='background-color:%s'><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td class='cycles'>%d</td><td class='cycles'>%d</td></tr>",
+			"<tr style='background-color:%s'><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td class='cycles'>%d</td><td class='cycles'>%d</td><td>%s</td><td>%s</td><td>%s</td></tr>",
 			color,
-			res.tcase.name,
-			isliceToString(res.tcase.input),
-			isliceToString(res.tcase.output),
-			isliceToString(res.output),
-			res.tcase.cycleLimit,
-			res.cycles,
+			res.Case.Name,
+			isliceToString(res.Case.Input),
+			html.EscapeString(lmc.FormatOutput(res.Case.Output, res.Case.Channels)),
+			html.EscapeString(lmc.FormatOutput(res.Output, res.Channels)),
+			res.Case.CycleLimit,
+			res.Cycles,
+			res.Status(),
+			errText,
+			strings.Join(notes, "<br>"),
 		))
 	}
 	t.fragments = append(t.fragments, strings.Join(trs, ""))
@@ -0,0 +1,41 @@
+package lmc
+
+// Arithmetic selects what ADD and SUB do with results that do
+// not fit in a mailbox.
+//
+// The accumulator and mailboxes always hold a value from 0 to
+// 999 (or the Max of the geometry), so STO can never store a
+// negative number:
+//
+//	ADD  r = acc + mem; r > 999 is an overflow
+//	SUB  r = acc - mem; r < 0 is an underflow and sets the
+//	     negative flag
+//
+// With Wrap, which is what the OG simulator does, the result is
+// taken modulo 1000: 990 + 20 = 010 and 5 - 10 = 995. With
+// Saturate, the result is clamped instead: 990 + 20 = 999 and
+// 5 - 10 = 000.
+//
+// In both cases the negative flag is what BRP looks at; the
+// accumulator itself is never negative. Which instructions
+// clear the flag depends on the NegRule of the dialect.
+type Arithmetic int
+
+const (
+	Wrap Arithmetic = iota
+	Saturate
+)
+
+// fit brings the result of ADD or SUB back into 0-max.
+func (a Arithmetic) fit(r int, max int) int {
+	if a == Saturate {
+		if r < 0 {
+			return 0
+		}
+		if r > max {
+			return max
+		}
+		return r
+	}
+	return (r%(max+1) + max + 1) % (max + 1)
+}
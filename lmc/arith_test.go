@@ -0,0 +1,72 @@
+package lmc
+
+import "fmt"
+import "testing"
+import "github.com/stretchr/testify/assert"
+
+type arithTest struct {
+	arith   Arithmetic
+	dialect *Dialect
+	acc     int
+	neg     bool // flag before the instruction
+	instr   int  // operand is always mailbox 50
+	operand int
+	wantAcc int
+	wantNeg bool
+}
+
+func TestArithmeticConformance(t *testing.T) {
+	tests := []arithTest{
+		// plain cases
+		{Wrap, OG, 1, false, 150, 2, 3, false},
+		{Wrap, OG, 5, false, 250, 5, 0, false},
+		{Wrap, OG, 999, false, 150, 0, 999, false},
+		// overflow wraps and never sets the flag
+		{Wrap, OG, 999, false, 150, 1, 0, false},
+		{Wrap, OG, 990, false, 150, 20, 10, false},
+		{Wrap, OG, 999, false, 150, 999, 998, false},
+		// underflow wraps and sets the flag
+		{Wrap, OG, 5, false, 250, 10, 995, true},
+		{Wrap, OG, 0, false, 250, 1, 999, true},
+		{Wrap, OG, 0, false, 250, 999, 1, true},
+		// ADD clears the flag, even without an overflow
+		{Wrap, OG, 995, true, 150, 1, 996, false},
+		{Wrap, OG, 995, true, 150, 10, 5, false},
+		// the flag is sticky across a SUB which does not
+		// underflow, unless the dialect says otherwise
+		{Wrap, OG, 995, true, 250, 1, 994, true},
+		{Wrap, Higginson, 995, true, 250, 1, 994, false},
+		{Wrap, Higginson, 5, false, 250, 10, 995, true},
+		// LDA clears the flag
+		{Wrap, OG, 995, true, 550, 7, 7, false},
+		// saturating arithmetic clamps instead
+		{Saturate, OG, 990, false, 150, 20, 999, false},
+		{Saturate, OG, 5, false, 250, 10, 0, true},
+		{Saturate, OG, 0, true, 250, 0, 0, true},
+		{Saturate, OG, 500, false, 150, 499, 999, false},
+	}
+	for _, c := range tests {
+		vm := newMachineFromSlice(Standard, nil)
+		vm.Arithmetic = c.arith
+		vm.Dialect = c.dialect
+		vm.Mem[0] = c.instr
+		vm.Mem[50] = c.operand
+		vm.Acc = c.acc
+		vm.Neg = c.neg
+		name := fmt.Sprintf("%+v", c)
+		assert.Equal(t, vm.Step(), nil, name)
+		assert.Equal(t, vm.Acc, c.wantAcc, name)
+		assert.Equal(t, vm.Neg, c.wantNeg, name)
+	}
+}
+
+func TestSTONeverNegative(t *testing.T) {
+	// 0 - 1 used to leave -1 in the accumulator, which STO
+	// would then store
+	vm := newMachineFromSlice(Standard, []int{250, 351, 0})
+	vm.Mem[50] = 1
+	_, err := vm.Run()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, vm.Mem[51], 999)
+	assert.Equal(t, vm.Neg, true)
+}
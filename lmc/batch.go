@@ -0,0 +1,401 @@
+package lmc
+
+import "strconv"
+import "errors"
+import "strings"
+import "bufio"
+import "io"
+import "fmt"
+import "sync"
+
+// Errors returned when parsing a test case.
+var ErrInvalidTestCase = errors.New("invalid test case")
+var ErrInvalidInputs = errors.New("invalid inputs")
+var ErrInvalidOutputs = errors.New("invalid outputs")
+var ErrInvalidCycles = errors.New("invalid cycles")
+
+// TestCase is a single line of a batch file.
+type TestCase struct {
+	Name       string
+	Input      []int
+	Output     []int
+	CycleLimit int
+	// Channels is set if the expected output was given as a
+	// string, in which case the output has to be characters.
+	Channels []Channel
+}
+
+// TestResult is the outcome of running a TestCase.
+type TestResult struct {
+	Case       TestCase
+	Output     []int
+	Channels   []Channel
+	Cycles     int
+	Terminated bool
+	Err        error
+	// SelfModifying is only recorded if the machine has a
+	// SelfModDetector.
+	SelfModifying []SelfModEvent
+	// UninitReads is only recorded if the machine has an
+	// UninitDetector.
+	UninitReads []UninitRead
+	// Devices is the activity of the devices attached to the
+	// machine.
+	Devices []DeviceEvent
+}
+
+func channelsEq(a []Channel, b []Channel) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i, x := range a {
+		if b[i] != x {
+			return false
+		}
+	}
+	return true
+}
+
+func isliceEq(a []int, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i, x := range a {
+		if b[i] != x {
+			return false
+		}
+	}
+	return true
+}
+
+// Failed reports whether the program was terminated or gave
+// the wrong output.
+func (t *TestResult) Failed() bool {
+	if t.Case.Channels != nil && !channelsEq(t.Case.Channels, t.Channels) {
+		return true
+	}
+	return t.Terminated || !isliceEq(t.Case.Output, t.Output)
+}
+
+// Statuses of a TestResult.
+const (
+	StatusPassed        = "passed"
+	StatusFailed        = "wrong output"
+	StatusOutOfCycles   = "out of cycles"
+	StatusOutOfInput    = "out of input"
+	StatusInfiniteLoop  = "infinite loop"
+	StatusSelfModifying = "self-modifying code"
+	StatusUninitialized = "uninitialized read"
+	StatusError         = "error"
+)
+
+// Status summarises the result as one of the Status constants.
+func (t *TestResult) Status() string {
+	switch {
+	case t.Err == nil && t.Failed():
+		return StatusFailed
+	case t.Err == nil:
+		return StatusPassed
+	case errors.Is(t.Err, ErrOutOfCycles):
+		return StatusOutOfCycles
+	case errors.Is(t.Err, ErrNoMoreInput):
+		return StatusOutOfInput
+	case errors.Is(t.Err, ErrInfiniteLoop):
+		return StatusInfiniteLoop
+	case errors.Is(t.Err, ErrSelfModifying):
+		return StatusSelfModifying
+	case errors.Is(t.Err, ErrUninitializedRead):
+		return StatusUninitialized
+	}
+	return StatusError
+}
+
+// RunTestCase runs a single test case on the machine, stopping
+// once the cycle limit of the test case has been reached.
+func RunTestCase(vm *Machine, t *TestCase) (r TestResult) {
+	// the cycle limit is only in effect for this test case; the
+	// full slice expression makes sure that we never append into
+	// an array shared with clones of the machine.
+	observers := vm.Observers
+	defer func() { vm.Observers = observers }()
+	vm.Observers = append(observers[:len(observers):len(observers)], CycleLimit{t.CycleLimit})
+	if len(vm.devices) > 0 {
+		vm.Observers = append(vm.Observers, ObserverFuncs{After: func(m *Machine, e Effect) error {
+			if e.Device != nil {
+				r.Devices = append(r.Devices, *e.Device)
+			}
+			return nil
+		}})
+	}
+	vm.Input = t.Input
+	vm.resetObservers()
+	var selfMod *SelfModDetector
+	var uninit *UninitDetector
+	for _, o := range observers {
+		switch d := o.(type) {
+		case *SelfModDetector:
+			selfMod = d
+		case *UninitDetector:
+			uninit = d
+		}
+	}
+	_, err := vm.Run()
+	r.Cycles = vm.Cycles
+	r.Case = *t
+	r.Output = vm.Output
+	r.Channels = vm.Channels
+	r.Terminated = (err != nil)
+	r.Err = err
+	if selfMod != nil {
+		r.SelfModifying = selfMod.Events
+	}
+	if uninit != nil {
+		r.UninitReads = uninit.Reads
+	}
+	return
+}
+
+// RunTestCases runs the given test cases using the given number
+// of workers, each of which gets its own clone of the vm. The
+// results are in the same order as the test cases, regardless
+// of the number of workers. At least one worker is used.
+func RunTestCases(workers int, vm *Machine, cases []TestCase) []TestResult {
+	if workers < 1 {
+		workers = 1
+	}
+	src := make(chan int, len(cases))
+	for i := range cases {
+		src <- i
+	}
+	close(src)
+	res := make([]TestResult, len(cases))
+	wg := sync.WaitGroup{}
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			vm := vm.Clone()
+			for i := range src {
+				// each worker only ever writes to its own
+				// slots so no locking is needed
+				vm.Restore()
+				res[i] = RunTestCase(vm, &cases[i])
+			}
+		}()
+	}
+	wg.Wait()
+	return res
+}
+
+// ParseInputs converts a list of strings to a list of values
+// in the range 0-999.
+func ParseInputs(strs []string) ([]int, error) {
+	return parseValues(strs, 999)
+}
+
+func parseValues(strs []string, max int) ([]int, error) {
+	b := []int{}
+	for i, s := range strs {
+		if i == 0 && s == "" {
+			continue
+		}
+		n, err := stoi(strings.TrimSpace(s), max)
+		if err != nil {
+			return nil, fmt.Errorf("cannot convert '%s' to int: %s", s, err)
+		}
+		b = append(b, n)
+	}
+	return b, nil
+}
+
+// stripComment removes a trailing comment, ignoring any #
+// inside a quoted string.
+func stripComment(s string) string {
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted = !quoted
+		case '#':
+			if !quoted {
+				return s[:i]
+			}
+		}
+	}
+	return s
+}
+
+// ParseOutputs parses the expected output of a test case, which
+// is either a list of numbers, or a quoted string of characters
+// such as "HELLO\n". Channels is nil for a list of numbers.
+func (g Geometry) ParseOutputs(s string) (outputs []int, channels []Channel, err error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, `"`) {
+		outputs, err = g.ParseInputs(strings.Split(s, ","))
+		return
+	}
+	text, err := strconv.Unquote(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	outputs = []int{}
+	channels = []Channel{}
+	for _, r := range text {
+		outputs = append(outputs, int(r))
+		channels = append(channels, Char)
+	}
+	return
+}
+
+func newTestCaseFromString(s string, g Geometry) (*TestCase, error) {
+	s = stripComment(s)
+	s = strings.TrimSpace(s)
+	if len(s) == 0 {
+		return nil, nil
+	}
+	// the outputs may be a string containing ';', so the
+	// cycle limit is taken from the end
+	contents := strings.SplitN(s, ";", 3)
+	if len(contents) != 3 || !strings.Contains(contents[2], ";") {
+		return nil, ErrInvalidTestCase
+	}
+	last := strings.LastIndex(contents[2], ";")
+	contents = append(contents[:2], contents[2][:last], contents[2][last+1:])
+	inputs, err := g.ParseInputs(strings.Split(contents[1], ","))
+	if err != nil {
+		return nil, ErrInvalidInputs
+	}
+	outputs, channels, err := g.ParseOutputs(contents[2])
+	if err != nil {
+		return nil, ErrInvalidOutputs
+	}
+	cycles, err := strconv.Atoi(contents[3])
+	if err != nil || cycles < 0 {
+		return nil, ErrInvalidCycles
+	}
+	return &TestCase{
+		Name:       contents[0],
+		Input:      inputs,
+		Output:     outputs,
+		CycleLimit: cycles,
+		Channels:   channels,
+	}, nil
+}
+
+// Batch is a parsed batch file.
+type Batch struct {
+	// Dialect is the dialect pinned by the file, or nil if
+	// the file does not pin one.
+	Dialect *Dialect
+	// Geometry is the geometry pinned by the file, or the zero
+	// geometry. It has to be pinned before any test case.
+	Geometry Geometry
+	// StackSize is the stack size pinned by the file, or 0.
+	StackSize int
+	// SelfModifying is "report" or "forbid" if the file asks
+	// for self-modifying code to be reported or to fail the
+	// test cases, or empty.
+	SelfModifying string
+	// Uninitialized is the same for uninitialized reads.
+	Uninitialized string
+	// Devices are the devices attached by the file.
+	Devices []Device
+	Cases   []TestCase
+}
+
+// parseDirective handles a line of the form "!name value".
+func (b *Batch) parseDirective(s string) error {
+	parts := strings.Fields(s[1:])
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid directive '%s'", s)
+	}
+	switch parts[0] {
+	case "dialect":
+		d, err := LookupDialect(parts[1])
+		if err != nil {
+			return err
+		}
+		b.Dialect = d
+		return nil
+	case "geometry":
+		if len(b.Cases) > 0 || len(b.Devices) > 0 {
+			return fmt.Errorf("geometry has to be set before any test case or device")
+		}
+		g, err := ParseGeometry(parts[1])
+		if err != nil {
+			return err
+		}
+		b.Geometry = g
+		return nil
+	case "stack":
+		n, err := strconv.Atoi(parts[1])
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid stack size '%s'", parts[1])
+		}
+		b.StackSize = n
+		return nil
+	case "device":
+		d, err := ParseDevice(parts[1], b.Geometry)
+		if err != nil {
+			return err
+		}
+		b.Devices = append(b.Devices, d)
+		return nil
+	case "self-modifying", "uninitialized":
+		if parts[1] != "report" && parts[1] != "forbid" {
+			return fmt.Errorf("invalid %s rule '%s', expected report or forbid", parts[0], parts[1])
+		}
+		if parts[0] == "uninitialized" {
+			b.Uninitialized = parts[1]
+		} else {
+			b.SelfModifying = parts[1]
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown directive '%s'", parts[0])
+}
+
+// ParseBatch reads a batch file.
+func ParseBatch(r io.Reader) (batch *Batch, errors []error) {
+	// Batch file format:
+	// # comment allowed
+	// !dialect higginson
+	// !geometry 1000x4
+	// !stack 10
+	// !self-modifying forbid
+	// !uninitialized report
+	// !device display=90:4
+	// Name;Inputs;Outputs;Cycle Limit
+	// Name;Inputs;"Text";Cycle Limit
+	batch = &Batch{}
+	lineNo := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "!") {
+			if err := batch.parseDirective(stripComment(line)); err != nil {
+				errors = append(errors, newError(lineNo, err.Error()))
+			}
+			continue
+		}
+		t, err := newTestCaseFromString(line, batch.Geometry.orStandard())
+		if err != nil {
+			errors = append(errors, newError(lineNo, err.Error()))
+			continue
+		}
+		if t == nil {
+			continue
+		}
+		batch.Cases = append(batch.Cases, *t)
+	}
+	return
+}
+
+// ParseTestCases reads the test cases from a batch file.
+func ParseTestCases(r io.Reader) (cases []TestCase, errors []error) {
+	batch, errors := ParseBatch(r)
+	return batch.Cases, errors
+}
@@ -0,0 +1,142 @@
+package lmc
+
+import "errors"
+import "strings"
+import "strconv"
+import "testing"
+import "github.com/stretchr/testify/assert"
+
+type batchLineTest struct {
+	line       string
+	name       string
+	input      []int
+	output     []int
+	cycleLimit int
+	err        error
+}
+
+func TestNewTestCaseFromString(t *testing.T) {
+	tests := []batchLineTest{
+		batchLineTest{"ABC", "", []int{}, []int{}, 0, ErrInvalidTestCase},
+		batchLineTest{"a;1,2,3;4;5", "a", []int{1, 2, 3}, []int{4}, 5, nil},
+		batchLineTest{"a;1,2,3;;5", "a", []int{1, 2, 3}, []int{}, 5, nil},
+		batchLineTest{"name;;4,5;5", "name", []int{}, []int{4, 5}, 5, nil},
+		batchLineTest{";1,2,3;;5", "", []int{1, 2, 3}, []int{}, 5, nil},
+		batchLineTest{"name;a,d;;5", "", []int{}, []int{}, 5, ErrInvalidInputs},
+		batchLineTest{"name;;a;5", "", []int{}, []int{}, 5, ErrInvalidOutputs},
+		batchLineTest{"name;;;a", "", []int{}, []int{}, 5, ErrInvalidCycles},
+		batchLineTest{"name;;;-1", "", []int{}, []int{}, 5, ErrInvalidCycles},
+		batchLineTest{`a;;"a;#";5 # text`, "a", []int{}, []int{'a', ';', '#'}, 5, nil},
+		batchLineTest{`a;;"a;5`, "", []int{}, []int{}, 5, ErrInvalidOutputs},
+	}
+	for _, c := range tests {
+		tc, err := newTestCaseFromString(c.line, Standard)
+		assert.Equal(t, c.err, err, c.line)
+		if err == nil {
+			assert.Equal(t, tc.Name, c.name)
+			assert.Equal(t, tc.Input, c.input)
+			assert.Equal(t, tc.Output, c.output)
+			assert.Equal(t, tc.CycleLimit, c.cycleLimit)
+		}
+	}
+}
+
+func TestBatchRestoresMemory(t *testing.T) {
+	r := strings.NewReader(`
+	LDA	x
+	ADD	one
+	STO	x
+	OUT
+	HLT
+x	DAT
+one	DAT	1`)
+	prog, errors := Compile(r)
+	assert.Equal(t, len(errors), 0, "No errors in compilation")
+	cases := []TestCase{
+		TestCase{"a", []int{}, []int{1}, 10, nil},
+		TestCase{"b", []int{}, []int{1}, 10, nil},
+		TestCase{"c", []int{}, []int{1}, 10, nil},
+	}
+	for _, res := range RunTestCases(1, NewMachine(prog), cases) {
+		assert.Equal(t, res.Output, []int{1}, res.Case.Name)
+		assert.Equal(t, res.Failed(), false, res.Case.Name)
+	}
+}
+
+func TestBatchOrdered(t *testing.T) {
+	r := strings.NewReader(`
+loop	IN
+	OUT
+	BR	loop`)
+	prog, errs := Compile(r)
+	assert.Equal(t, len(errs), 0, "No errors in compilation")
+	cases := []TestCase{}
+	for i := 0; i < 50; i++ {
+		// vary the number of cycles so that the cases
+		// finish at different times
+		input := make([]int, 50-i)
+		cases = append(cases, TestCase{strconv.Itoa(i), input, input, 1000, nil})
+	}
+	for _, workers := range []int{0, 1, 4, 16} {
+		results := RunTestCases(workers, NewMachine(prog), cases)
+		for i, res := range results {
+			assert.Equal(t, res.Case.Name, strconv.Itoa(i))
+			assert.Equal(t, res.Output, cases[i].Output)
+			assert.Equal(t, errors.Is(res.Err, ErrNoMoreInput), true)
+		}
+	}
+}
+
+func TestBatchErrors(t *testing.T) {
+	r := strings.NewReader(`
+loop	BR	loop`)
+	prog, errs := Compile(r)
+	assert.Equal(t, len(errs), 0, "No errors in compilation")
+	cases := []TestCase{TestCase{"a", []int{}, []int{}, 10, nil}}
+	vm := NewMachine(prog)
+	results := RunTestCases(1, vm, cases)
+	assert.Equal(t, errors.Is(results[0].Err, ErrOutOfCycles), true)
+	assert.Equal(t, results[0].Err.Error(), "line 2 (mailbox 00, BR): cycle limit of 10 reached")
+	assert.Equal(t, results[0].Cycles, 10)
+	assert.Equal(t, results[0].Failed(), true)
+}
+
+func TestParseBatch(t *testing.T) {
+	b, errs := ParseBatch(strings.NewReader(`
+!dialect 101computing # pinned
+a;1;1;10
+!dialect foo
+!cycles 10`))
+	assert.Equal(t, b.Dialect, Computing101)
+	assert.Equal(t, len(b.Cases), 1)
+	assert.Equal(t, errs, []error{
+		newError(4, "unknown dialect 'foo'"),
+		newError(5, "unknown directive 'cycles'"),
+	})
+}
+
+func TestTextOutput(t *testing.T) {
+	r := strings.NewReader(`
+	LDA	h
+	OTC
+	LDA	i
+	OTC
+	OUT
+	HLT
+h	DAT	72
+i	DAT	73`)
+	prog, errs := CompileDialect(r, OGText)
+	assert.Equal(t, len(errs), 0, "No errors in compilation")
+	cases := []TestCase{}
+	for _, s := range []string{`a;;"HI";10`, `b;;"HII";10`, `c;;72,73,73;10`} {
+		tc, err := newTestCaseFromString(s, Standard)
+		assert.Equal(t, err, nil)
+		cases = append(cases, *tc)
+	}
+	res := RunTestCases(1, NewMachine(prog), cases)
+	assert.Equal(t, res[0].Failed(), true)
+	assert.Equal(t, res[1].Failed(), true)
+	assert.Equal(t, res[2].Failed(), false)
+	assert.Equal(t, res[0].Channels, []Channel{Char, Char, Numeric})
+	assert.Equal(t, FormatOutput(res[0].Output, res[0].Channels), `"HI", 73`)
+}
@@ -0,0 +1,297 @@
+// Package lmc implements the assembler, virtual machine and
+// batch runner behind yalmc, for use by other Go programs.
+package lmc
+
+import "io"
+import "bufio"
+import "fmt"
+import "strings"
+import "strconv"
+
+// instrLookup is the instruction set of the OG dialect.
+var instrLookup = map[string]int{
+	"ADD": 100,
+	"SUB": 200,
+	"STO": 300,
+	"LDA": 500,
+	"BR":  600,
+	"BRZ": 700,
+	"BRP": 800,
+	"IN":  901,
+	"OUT": 902,
+	"HLT": 000,
+	"DAT": -1, // special for DAT
+}
+
+// ParseError is returned when a line of code or a test case
+// cannot be parsed.
+type ParseError struct {
+	Line   int
+	Reason string
+}
+
+func newError(line int, reason string) error {
+	return ParseError{line, reason}
+}
+
+func (e ParseError) Error() string {
+	return fmt.Sprintf("Line %d: %s", e.Line, e.Reason)
+}
+
+func stoi(s string, max int) (int, error) {
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	if i > max || i < 0 {
+		return 0, fmt.Errorf("number not in range 0-%d", max)
+	}
+	return i, nil
+}
+
+// Line is a single line of parsed code.
+type Line struct {
+	Text   string
+	LineNo int
+	Column int // column of the instruction, starting from 1
+	Label  string
+	Instr  string
+	Addr   string
+}
+
+func newLineFromString(lineNo int, s string) (*Line, error) {
+	s = strings.SplitN(s, "#", 2)[0]
+	if len(strings.TrimSpace(s)) == 0 {
+		return nil, nil
+	}
+	parts := strings.Fields(s)
+	if len(parts) > 3 {
+		return nil, newError(lineNo, "unexpected content after address section")
+	}
+	if s[0] == ' ' || s[0] == '\t' {
+		c := []string{""}
+		parts = append(c, parts...)
+	}
+	if len(parts) < 2 {
+		return nil, newError(lineNo, "got label with no instruction")
+	}
+	label := parts[0]
+	instr := parts[1]
+	addr := ""
+	if len(parts) == 3 {
+		addr = parts[2]
+	}
+	// the instruction is the first occurrence after the label
+	offset := strings.Index(s, label) + len(label)
+	column := offset + strings.Index(s[offset:], instr) + 1
+	return &Line{
+		Text:   s,
+		LineNo: lineNo,
+		Column: column,
+		Label:  label,
+		Instr:  strings.ToUpper(instr),
+		Addr:   addr,
+	}, nil
+}
+
+func (l *Line) toData(labels map[string]int, a Assembler) (int, error) {
+	g := a.Geometry.orStandard()
+	op, ok := a.dialect().Mnemonics[l.Instr]
+	if !ok && a.StackSize > 0 {
+		op, ok = stackLookup[l.Instr]
+	}
+	for _, d := range a.Devices {
+		if p, isPort := d.(PortDevice); isPort && !ok {
+			op, ok = p.Ports()[l.Instr]
+		}
+	}
+	if !ok {
+		return 0, newError(l.LineNo, fmt.Sprintf("invalid instruction '%s'", l.Instr))
+	}
+	// HLT / IN / OUT / OTC instructions can be on their own
+	// without any address component
+	if op == 0 || op > 900 {
+		return g.encode(op), nil
+	}
+	// DAT [xxx], defaults to 0
+	if op == -1 {
+		if l.Addr == "" {
+			return 0, nil
+		}
+		return stoi(l.Addr, g.Max())
+	}
+	op = g.encode(op)
+	// Instructions other than IN/OUT/HLT need a target address
+	// so if we are not given one, error out.
+	if l.Addr == "" {
+		return 0, newError(l.LineNo, "no address given")
+	}
+	if i, ok := labels[l.Addr]; ok {
+		return op + i, nil
+	}
+	i, err := stoi(l.Addr, g.Mailboxes-1)
+	if err != nil {
+		err = newError(l.LineNo, fmt.Sprintf("invalid address/label: %s", l.Addr))
+	}
+	return op + i, err
+}
+
+func labelsOf(lines []*Line) map[string]int {
+	labels := map[string]int{}
+	for mailbox, line := range lines {
+		if len(line.Label) > 0 {
+			labels[line.Label] = mailbox
+		}
+	}
+	return labels
+}
+
+func linesToInt(lines []*Line, a Assembler) ([]int, error) {
+	// Perform 1 pass to first index the positions of the
+	// mailboxes in the code so that it is possible to reference
+	// a label after/before it is defined
+	labels := labelsOf(lines)
+	// Fill up the mailboxes by parsing the instructions
+	buff := make([]int, a.Geometry.orStandard().Mailboxes)
+	for i, line := range lines {
+		instr, err := line.toData(labels, a)
+		buff[i] = instr
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buff, nil
+}
+
+func parse(r io.Reader, mailboxes int) ([]*Line, []error) {
+	i := 0            // current mailbox number
+	lineNo := 0       // current line number
+	buff := []*Line{} // compile buffer
+	errors := []error{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		s := scanner.Text()
+		lineNo++
+		line, err := newLineFromString(lineNo, s)
+		if err == nil && line == nil {
+			// Empty line / only comments so don't bother incrementing
+			// mailbox number
+			continue
+		}
+		i++
+		if i > mailboxes { // Reached mailbox limit
+			errors = append(errors, newError(lineNo, "out of mailboxes"))
+			break
+		}
+		if err != nil {
+			errors = append(errors, err)
+			continue
+		}
+		buff = append(buff, line)
+	}
+	return buff, errors
+}
+
+// Program is the output of the compiler: the memory image,
+// the label table, and the source line of each mailbox.
+type Program struct {
+	Mem      []int
+	Labels   map[string]int
+	Lines    []*Line // Lines[i] is the source of mailbox i
+	Dialect  *Dialect
+	Geometry Geometry
+	// StackSize is the number of mailboxes reserved for the
+	// stack, see Assembler.
+	StackSize int
+}
+
+// Size returns the number of mailboxes used by the program.
+func (p *Program) Size() int {
+	return len(p.Lines)
+}
+
+// Source returns the line and column that the given mailbox
+// was compiled from, if any.
+func (p *Program) Source(mailbox int) (line int, column int, ok bool) {
+	if mailbox < 0 || mailbox >= len(p.Lines) {
+		return 0, 0, false
+	}
+	l := p.Lines[mailbox]
+	return l.LineNo, l.Column, true
+}
+
+// LineAt returns the source line of the given mailbox, or
+// nil if the mailbox is not part of the program.
+func (p *Program) LineAt(mailbox int) *Line {
+	if mailbox < 0 || mailbox >= len(p.Lines) {
+		return nil
+	}
+	return p.Lines[mailbox]
+}
+
+// Initialized reports whether the assembler gave the mailbox a
+// value, i.e. it holds an instruction or a DAT with a value.
+func (p *Program) Initialized(mailbox int) bool {
+	line := p.LineAt(mailbox)
+	return line != nil && (line.Instr != "DAT" || line.Addr != "")
+}
+
+// Compile parses and assembles the code read from r using the
+// OG dialect.
+func Compile(r io.Reader) (*Program, []error) {
+	return Assembler{}.Compile(r)
+}
+
+// CompileDialect is like Compile, but uses the mnemonics of the
+// given dialect.
+func CompileDialect(r io.Reader, d *Dialect) (*Program, []error) {
+	return Assembler{Dialect: d}.Compile(r)
+}
+
+// Assembler holds the settings used to compile code. The zero
+// value compiles for the OG dialect and the Standard geometry.
+type Assembler struct {
+	Dialect  *Dialect
+	Geometry Geometry
+	// StackSize enables CALL, RET, PUSH and POP, and reserves
+	// that many mailboxes at the end of memory for the stack.
+	StackSize int
+	// Devices adds the mnemonics of the instructions claimed
+	// by the devices. The devices still have to be attached to
+	// the machine.
+	Devices []Device
+}
+
+func (a Assembler) dialect() *Dialect {
+	if a.Dialect == nil {
+		return OG
+	}
+	return a.Dialect
+}
+
+// Compile parses and assembles the code read from r.
+func (a Assembler) Compile(r io.Reader) (*Program, []error) {
+	g := a.Geometry.orStandard()
+	if err := g.Validate(); err != nil {
+		return nil, []error{err}
+	}
+	if a.StackSize < 0 || a.StackSize >= g.Mailboxes {
+		return nil, []error{fmt.Errorf("stack size must be between 0 and %d", g.Mailboxes-1)}
+	}
+	lines, errors := parse(r, g.Mailboxes-a.StackSize)
+	if len(errors) != 0 {
+		return nil, errors
+	}
+	code, err := linesToInt(lines, a)
+	if err != nil {
+		return nil, []error{err}
+	}
+	return &Program{
+		Mem:       code,
+		Labels:    labelsOf(lines),
+		Lines:     lines,
+		Dialect:   a.dialect(),
+		Geometry:  g,
+		StackSize: a.StackSize,
+	}, nil
+}
@@ -1,4 +1,4 @@
-package main
+package lmc
 
 import "strings"
 import "testing"
@@ -10,28 +10,31 @@ type lineFromStringTest struct {
 	label  string // label
 	instr  string // instruction
 	addr   string // address
+	column int    // column of instruction
 	line   bool   // line != nil
 	err    bool   // err != nil
 }
 
 func TestStringToLine(t *testing.T) {
 	tests := []lineFromStringTest{
-		lineFromStringTest{"\tLDA\tabc", 10, "", "LDA", "abc", true, false},
-		lineFromStringTest{" LDA\t123", 10, "", "LDA", "123", true, false},
-		lineFromStringTest{"abc\tLDA\tghi", 10, "abc", "LDA", "ghi", true, false},
-		lineFromStringTest{"\tLDA\tabc #def", 10, "", "LDA", "abc", true, false},
-		lineFromStringTest{"abc", 10, "", "", "", true, true},
-		lineFromStringTest{"", 10, "", "", "", false, false},
-		lineFromStringTest{"abc LDA\tabc\tdef", 10, "", "", "", false, true},
+		lineFromStringTest{"\tLDA\tabc", 10, "", "LDA", "abc", 2, true, false},
+		lineFromStringTest{" LDA\t123", 10, "", "LDA", "123", 2, true, false},
+		lineFromStringTest{"abc\tLDA\tghi", 10, "abc", "LDA", "ghi", 5, true, false},
+		lineFromStringTest{"\tLDA\tabc #def", 10, "", "LDA", "abc", 2, true, false},
+		lineFromStringTest{"LDA\tLDA\tLDA", 10, "LDA", "LDA", "LDA", 5, true, false},
+		lineFromStringTest{"abc", 10, "", "", "", 0, true, true},
+		lineFromStringTest{"", 10, "", "", "", 0, false, false},
+		lineFromStringTest{"abc LDA\tabc\tdef", 10, "", "", "", 0, false, true},
 	}
 	for _, c := range tests {
 		line, err := newLineFromString(c.lineNo, c.text)
 		assert.Equal(t, err != nil, c.err, c.text)
 		if c.line && !c.err {
-			assert.Equal(t, line.lineNo, c.lineNo)
-			assert.Equal(t, line.label, c.label)
-			assert.Equal(t, line.instr, c.instr)
-			assert.Equal(t, line.addr, c.addr)
+			assert.Equal(t, line.LineNo, c.lineNo)
+			assert.Equal(t, line.Column, c.column)
+			assert.Equal(t, line.Label, c.label)
+			assert.Equal(t, line.Instr, c.instr)
+			assert.Equal(t, line.Addr, c.addr)
 		}
 	}
 }
@@ -46,68 +49,68 @@ type lineToDataTest struct {
 func TestLineToData(t *testing.T) {
 	tests := []lineToDataTest{
 		lineToDataTest{
-			line:   Line{lineNo: 5, label: "", instr: "LDA", addr: "057"},
+			line:   Line{LineNo: 5, Label: "", Instr: "LDA", Addr: "057"},
 			labels: map[string]int{},
 			err:    false,
 			data:   557,
 		},
 		lineToDataTest{
-			line:   Line{lineNo: 5, label: "", instr: "LDA", addr: "abc"},
+			line:   Line{LineNo: 5, Label: "", Instr: "LDA", Addr: "abc"},
 			labels: map[string]int{"abc": 12},
 			err:    false,
 			data:   512,
 		},
 		lineToDataTest{
-			line:   Line{lineNo: 5, label: "", instr: "DAT", addr: "009"},
+			line:   Line{LineNo: 5, Label: "", Instr: "DAT", Addr: "009"},
 			labels: map[string]int{},
 			err:    false,
 			data:   9,
 		},
 		lineToDataTest{
-			line:   Line{lineNo: 5, label: "", instr: "DAT", addr: "label"},
+			line:   Line{LineNo: 5, Label: "", Instr: "DAT", Addr: "label"},
 			labels: map[string]int{"label": 1},
 			err:    true,
 			data:   0,
 		},
 		lineToDataTest{
-			line:   Line{lineNo: 5, label: "abc", instr: "IN", addr: ""},
+			line:   Line{LineNo: 5, Label: "abc", Instr: "IN", Addr: ""},
 			labels: map[string]int{},
 			err:    false,
 			data:   901,
 		},
 		lineToDataTest{
-			line:   Line{lineNo: 5, label: "abc", instr: "DAT", addr: "1000"},
+			line:   Line{LineNo: 5, Label: "abc", Instr: "DAT", Addr: "1000"},
 			labels: map[string]int{},
 			err:    true,
 			data:   901,
 		},
 		lineToDataTest{
-			line:   Line{lineNo: 5, label: "abc", instr: "STO", addr: ""},
+			line:   Line{LineNo: 5, Label: "abc", Instr: "STO", Addr: ""},
 			labels: map[string]int{},
 			err:    true,
 			data:   0,
 		},
 		lineToDataTest{
-			line:   Line{lineNo: 5, label: "abc", instr: "DAT", addr: ""},
+			line:   Line{LineNo: 5, Label: "abc", Instr: "DAT", Addr: ""},
 			labels: map[string]int{},
 			err:    false,
 			data:   0,
 		},
 		lineToDataTest{
-			line:   Line{lineNo: 5, label: "", instr: "STO", addr: "def"},
+			line:   Line{LineNo: 5, Label: "", Instr: "STO", Addr: "def"},
 			labels: map[string]int{"abc": 1},
 			err:    true,
 			data:   0,
 		},
 		lineToDataTest{
-			line:   Line{lineNo: 5, label: "", instr: "FOO", addr: "def"},
+			line:   Line{LineNo: 5, Label: "", Instr: "FOO", Addr: "def"},
 			labels: map[string]int{"abc": 1},
 			err:    true,
 			data:   0,
 		},
 	}
 	for _, c := range tests {
-		data, err := c.line.toData(c.labels)
+		data, err := c.line.toData(c.labels, Assembler{})
 		assert.Equal(t, err != nil, c.err)
 		if !c.err {
 			assert.Equal(t, data, c.data)
@@ -125,7 +128,7 @@ st	IN
 lab	HLT
 inp	DAT 100
 	`)
-	code, mailboxes, errors := compile(r)
+	prog, errors := Compile(r)
 	buff := make([]int, 100)
 	buff[0] = 901
 	buff[1] = 305
@@ -134,6 +137,13 @@ inp	DAT 100
 	buff[4] = 0
 	buff[5] = 100
 	assert.Equal(t, len(errors), 0)
-	assert.Equal(t, code, buff)
-	assert.Equal(t, mailboxes, 6)
+	assert.Equal(t, prog.Mem, buff)
+	assert.Equal(t, prog.Size(), 6)
+	assert.Equal(t, prog.Labels, map[string]int{"st": 0, "lab": 4, "inp": 5})
+	line, column, ok := prog.Source(1)
+	assert.Equal(t, []interface{}{line, column, ok}, []interface{}{4, 2, true})
+	line, column, ok = prog.Source(4)
+	assert.Equal(t, []interface{}{line, column, ok}, []interface{}{7, 5, true})
+	_, _, ok = prog.Source(6)
+	assert.Equal(t, ok, false)
 }
@@ -0,0 +1,175 @@
+package lmc
+
+import "errors"
+import "fmt"
+
+// ErrDeviceClaim is wrapped by the errors returned when a device
+// cannot be attached to a machine.
+var ErrDeviceClaim = errors.New("cannot attach device")
+
+// Device is a peripheral attached to a machine. A device claims
+// either instruction codes, see PortDevice, or a range of
+// mailboxes, see MemoryDevice. Device state is not part of a
+// snapshot, and StepBack does not undo it.
+type Device interface {
+	Name() string
+	// Clone returns a copy of the device in its initial state,
+	// for a clone of the machine.
+	Clone() Device
+	// Reset brings the device back to its initial state. It
+	// is called by Machine.Restore.
+	Reset()
+}
+
+// PortDevice is a device which claims 9xx instruction codes that
+// are undefined in the dialect of the machine.
+type PortDevice interface {
+	Device
+	// Ports maps the mnemonics of the claimed instructions
+	// to their 3 digit codes, e.g. "RND": 931.
+	Ports() map[string]int
+	// Execute runs the instruction with the given code, and
+	// returns the value exchanged with the device.
+	Execute(m *Machine, code int) (int, error)
+}
+
+// MemoryDevice is a device which claims a range of mailboxes.
+// Reads of the mailboxes by LDA, ADD and SUB go to the device,
+// while STO writes to both the mailbox and the device.
+type MemoryDevice interface {
+	Device
+	// Mailboxes returns the first mailbox and the number of
+	// mailboxes claimed.
+	Mailboxes() (first int, n int)
+	Load(offset int) int
+	Store(offset int, value int)
+}
+
+// DeviceEvent is a single interaction with a device.
+type DeviceEvent struct {
+	Device string `json:"device"`
+	Op     string `json:"op"` // mnemonic of a port, or "read" or "write"
+	Value  int    `json:"value"`
+}
+
+func (e DeviceEvent) String() string {
+	return fmt.Sprintf("%s: %s %d", e.Device, e.Op, e.Value)
+}
+
+// port is an instruction code claimed by a PortDevice.
+type port struct {
+	device PortDevice
+	name   string
+}
+
+// Devices returns the devices attached to the machine.
+func (c *Machine) Devices() []Device {
+	return c.devices
+}
+
+// Attach attaches a device to the machine. Instruction codes
+// have to be undefined, and mailboxes cannot be part of the
+// program or the stack. No two devices can claim the same code
+// or mailbox.
+func (c *Machine) Attach(d Device) error {
+	p, isPort := d.(PortDevice)
+	m, isMemory := d.(MemoryDevice)
+	if !isPort && !isMemory {
+		return fmt.Errorf("%w %s: it claims neither instructions nor mailboxes", ErrDeviceClaim, d.Name())
+	}
+	if isPort {
+		g := c.geometry()
+		for name, code := range p.Ports() {
+			if code < 900 || code > 999 {
+				return fmt.Errorf("%w %s: %s is not a 9xx instruction", ErrDeviceClaim, d.Name(), name)
+			}
+			if c.Mnemonic(g.encode(code)) != "???" {
+				return fmt.Errorf("%w %s: instruction %03d is already defined", ErrDeviceClaim, d.Name(), code)
+			}
+		}
+	}
+	if isMemory {
+		first, n := m.Mailboxes()
+		w := c.geometry().AddrWidth()
+		if first < 0 || n <= 0 || first+n > len(c.Mem)-c.StackSize {
+			return fmt.Errorf("%w %s: mailboxes %0*d-%0*d are not available", ErrDeviceClaim, d.Name(), w, first, w, first+n-1)
+		}
+		if c.prog != nil && first < len(c.prog.Lines) {
+			return fmt.Errorf("%w %s: mailbox %0*d is part of the program", ErrDeviceClaim, d.Name(), w, first)
+		}
+		for _, other := range c.mapped {
+			start, count := other.Mailboxes()
+			if first < start+count && start < first+n {
+				return fmt.Errorf("%w %s: mailboxes %0*d-%0*d are claimed by %s", ErrDeviceClaim, d.Name(), w, first, w, first+n-1, other.Name())
+			}
+		}
+		c.mapped = append(c.mapped, m)
+	}
+	if isPort {
+		if c.ports == nil {
+			c.ports = map[int]port{}
+		}
+		for name, code := range p.Ports() {
+			c.ports[code-900] = port{p, name}
+		}
+	}
+	c.devices = append(c.devices, d)
+	return nil
+}
+
+// cloneDevices attaches clones of the devices of c to vm.
+func (c *Machine) cloneDevices(vm *Machine) {
+	vm.devices = nil
+	vm.ports = nil
+	vm.mapped = nil
+	for _, d := range c.devices {
+		// the claims have already been checked
+		vm.Attach(d.Clone())
+	}
+}
+
+// device returns the memory device mapped to the mailbox, and
+// the offset of the mailbox within the device.
+func (c *Machine) device(addr int) (MemoryDevice, int, bool) {
+	for _, m := range c.mapped {
+		first, n := m.Mailboxes()
+		if addr >= first && addr < first+n {
+			return m, addr - first, true
+		}
+	}
+	return nil, 0, false
+}
+
+// load reads a mailbox, going to the device if it is mapped.
+func (c *Machine) load(addr int) int {
+	if c.mapped != nil {
+		if m, offset, ok := c.device(addr); ok {
+			n := m.Load(offset)
+			c.Last.Device = &DeviceEvent{m.Name(), "read", n}
+			return n
+		}
+	}
+	return c.Mem[addr]
+}
+
+// store tells the device mapped to the mailbox about a write.
+func (c *Machine) store(addr int, n int) {
+	if c.mapped != nil {
+		if m, offset, ok := c.device(addr); ok {
+			m.Store(offset, n)
+			c.Last.Device = &DeviceEvent{m.Name(), "write", n}
+		}
+	}
+}
+
+// execPort runs a port instruction, reporting false if no device
+// claims it.
+func (c *Machine) execPort(addr int) (bool, error) {
+	p, ok := c.ports[addr]
+	if !ok {
+		return false, nil
+	}
+	n, err := p.device.Execute(c, addr+900)
+	c.Last.Device = &DeviceEvent{p.device.Name(), p.name, n}
+	return true, err
+}
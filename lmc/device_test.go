@@ -0,0 +1,144 @@
+package lmc
+
+import "errors"
+import "strings"
+import "testing"
+import "github.com/stretchr/testify/assert"
+
+func compileWithDevices(t *testing.T, code string, devices ...Device) *Machine {
+	prog, errs := Assembler{Devices: devices}.Compile(strings.NewReader(code))
+	assert.Equal(t, len(errs), 0, "No errors in compilation")
+	vm := NewMachine(prog)
+	for _, d := range devices {
+		assert.Equal(t, vm.Attach(d), nil, d.Name())
+	}
+	return vm
+}
+
+func TestPortDevices(t *testing.T) {
+	vm := compileWithDevices(t, `
+	KEY
+	OUT
+	KEY
+	OUT
+	KEY
+	OUT
+	CLK
+	OUT
+	RND
+	OUT
+	HLT`, NewKeyboard('a', 'b'), Clock{}, NewRNG(1))
+	vm.Strict = true
+	output, err := vm.Run()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, output[:4], []int{'a', 'b', 0, 7})
+	assert.Equal(t, vm.Mnemonic(931), "RND")
+	// the machine is reset along with the devices
+	random := output[4]
+	vm.Restore()
+	output, _ = vm.Run()
+	assert.Equal(t, output, []int{'a', 'b', 0, 7, random})
+	clone := vm.Clone()
+	clone.Restore()
+	output, _ = clone.Run()
+	assert.Equal(t, output, []int{'a', 'b', 0, 7, random})
+}
+
+func TestDisplay(t *testing.T) {
+	d := NewDisplay(10, 2)
+	vm := compileWithDevices(t, `
+	LDA	x
+	STO	10
+	ADD	10
+	STO	11
+	LDA	11
+	OUT
+	HLT
+x	DAT	7`, d)
+	events := []*DeviceEvent{}
+	vm.Observers = []Observer{ObserverFuncs{After: func(m *Machine, e Effect) error {
+		events = append(events, e.Device)
+		return nil
+	}}}
+	output, err := vm.Run()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, output, []int{14})
+	assert.Equal(t, d.String(), "74")
+	assert.Equal(t, vm.Mem[10:12], []int{7, 14})
+	assert.Equal(t, *events[1], DeviceEvent{"display", "write", 7})
+	assert.Equal(t, *events[2], DeviceEvent{"display", "read", 7})
+	assert.Equal(t, events[5], (*DeviceEvent)(nil))
+}
+
+func TestAttachErrors(t *testing.T) {
+	prog, errs := Assembler{StackSize: 10}.Compile(strings.NewReader(`
+	IN
+	OUT
+	HLT`))
+	assert.Equal(t, len(errs), 0, "No errors in compilation")
+	vm := NewMachine(prog)
+	assert.Equal(t, vm.Attach(NewDisplay(50, 4)), nil)
+	assert.Equal(t, vm.Attach(NewRNG(0)), nil)
+	for _, d := range []Device{
+		NewDisplay(1, 2),
+		NewDisplay(52, 4),
+		NewDisplay(88, 4),
+		NewRNG(1),
+	} {
+		err := vm.Attach(d)
+		assert.Equal(t, errors.Is(err, ErrDeviceClaim), true, d)
+	}
+	assert.Equal(t, vm.Attach(NewDisplay(1, 2)).Error(), "cannot attach device display: mailbox 01 is part of the program")
+	assert.Equal(t, vm.Attach(NewRNG(0)).Error(), "cannot attach device rng: instruction 931 is already defined")
+	assert.Equal(t, len(vm.Devices()), 2)
+}
+
+func TestParseDevice(t *testing.T) {
+	tests := []struct {
+		spec   string
+		device Device
+		err    string
+	}{
+		{"clock", Clock{}, ""},
+		{"rng=42", NewRNG(42), ""},
+		{"keyboard=ab", NewKeyboard('a', 'b'), ""},
+		{"display=90", NewDisplay(90, 4), ""},
+		{"display=90:2", NewDisplay(90, 2), ""},
+		{"display=x", nil, "invalid display 'x', expected FIRST:N"},
+		{"rng=x", nil, "invalid seed 'x'"},
+		{"printer", nil, "unknown device 'printer'"},
+		{"keyboard=a€", nil, "key '€' does not fit in 3 digits"},
+	}
+	for _, c := range tests {
+		d, err := ParseDevice(c.spec, Standard)
+		if c.err != "" {
+			assert.Equal(t, err.Error(), c.err, c.spec)
+			continue
+		}
+		assert.Equal(t, err, nil, c.spec)
+		assert.Equal(t, d.Name(), c.device.Name(), c.spec)
+	}
+}
+
+func TestDeviceBatch(t *testing.T) {
+	b, errs := ParseBatch(strings.NewReader(`
+!device rng=3
+!device display=20:1
+a;;;10`))
+	assert.Equal(t, len(errs), 0)
+	vm := compileWithDevices(t, `
+	RND
+	STO	20
+	HLT`, b.Devices...)
+	res := RunTestCases(2, vm, append(b.Cases, b.Cases...))
+	assert.Equal(t, len(res[0].Devices), 2)
+	assert.Equal(t, res[0].Devices, res[1].Devices)
+	assert.Equal(t, res[0].Devices[1].Op, "write")
+	// the geometry decides which keys fit
+	b, errs = ParseBatch(strings.NewReader(`
+!geometry 1000x4
+!device keyboard=€
+!geometry 100x3`))
+	assert.Equal(t, len(b.Devices), 1)
+	assert.Equal(t, errs[0], newError(4, "geometry has to be set before any test case or device"))
+}
@@ -0,0 +1,161 @@
+package lmc
+
+import "errors"
+import "fmt"
+import "strings"
+
+// ErrUnknownDialect is returned by LookupDialect when there is no
+// dialect with the given name.
+var ErrUnknownDialect error = errors.New("unknown dialect")
+
+// NegRule is how the negative flag is set by ADD and SUB.
+type NegRule int
+
+const (
+	// NegSticky sets the flag when SUB goes below zero; only
+	// ADD, LDA and IN clear it, so it stays set across a SUB
+	// that does not underflow. This is what the OG simulator
+	// does.
+	NegSticky NegRule = iota
+	// NegResult sets or clears the flag after every ADD and SUB
+	// depending on whether the result went below zero.
+	NegResult
+)
+
+// Dialect describes the instruction set understood by a given
+// LMC simulator. It controls both the assembler and the machine.
+type Dialect struct {
+	Name string
+	// Mnemonics maps each mnemonic to its opcode; DAT is -1.
+	Mnemonics map[string]int
+	// Names is the mnemonic shown for each opcode, keyed by
+	// the opcode multiplied by 100, or by the word for 9xx.
+	Names map[int]string
+	// OTC defines 922, which outputs the accumulator as a
+	// character code.
+	OTC bool
+	Neg NegRule
+}
+
+// OG is the dialect of the OG simulator, and the default.
+var OG = &Dialect{
+	Name:      "og",
+	Mnemonics: instrLookup,
+	Names: map[int]string{
+		0: "HLT", 100: "ADD", 200: "SUB", 300: "STO", 500: "LDA",
+		600: "BR", 700: "BRZ", 800: "BRP", 901: "IN", 902: "OUT",
+	},
+	Neg: NegSticky,
+}
+
+// OGText is the OG dialect with OTC added, for programs which
+// output text but otherwise stick to the OG instruction set.
+var OGText = withOTC(OG, "og-text")
+
+// withOTC returns a copy of the dialect called name, with OTC
+// added to its tables.
+func withOTC(d *Dialect, name string) *Dialect {
+	c := *d
+	c.Name = name
+	c.Mnemonics = map[string]int{"OTC": 922}
+	for mnemonic, code := range d.Mnemonics {
+		c.Mnemonics[mnemonic] = code
+	}
+	c.Names = map[int]string{922: "OTC"}
+	for code, mnemonic := range d.Names {
+		c.Names[code] = mnemonic
+	}
+	c.OTC = true
+	return &c
+}
+
+// Higginson is the dialect of Peter Higginson's simulator.
+var Higginson = &Dialect{
+	Name: "higginson",
+	Mnemonics: map[string]int{
+		"ADD": 100,
+		"SUB": 200,
+		"STA": 300,
+		"LDA": 500,
+		"BRA": 600,
+		"BRZ": 700,
+		"BRP": 800,
+		"INP": 901,
+		"OUT": 902,
+		"OTC": 922,
+		"HLT": 000,
+		"COB": 000,
+		"DAT": -1,
+	},
+	Names: map[int]string{
+		0: "HLT", 100: "ADD", 200: "SUB", 300: "STA", 500: "LDA",
+		600: "BRA", 700: "BRZ", 800: "BRP", 901: "INP", 902: "OUT",
+		922: "OTC",
+	},
+	OTC: true,
+	Neg: NegResult,
+}
+
+// Computing101 is the dialect of the 101computing.net simulator.
+var Computing101 = &Dialect{
+	Name: "101computing",
+	Mnemonics: map[string]int{
+		"ADD": 100,
+		"SUB": 200,
+		"STA": 300,
+		"LDA": 500,
+		"BRA": 600,
+		"BRZ": 700,
+		"BRP": 800,
+		"INP": 901,
+		"OUT": 902,
+		"OTC": 922,
+		"HLT": 000,
+		"DAT": -1,
+	},
+	Names: map[int]string{
+		0: "HLT", 100: "ADD", 200: "SUB", 300: "STA", 500: "LDA",
+		600: "BRA", 700: "BRZ", 800: "BRP", 901: "INP", 902: "OUT",
+		922: "OTC",
+	},
+	OTC: true,
+	Neg: NegResult,
+}
+
+var dialects = []*Dialect{OG, OGText, Higginson, Computing101}
+
+// LookupDialect returns the dialect with the given name.
+func LookupDialect(name string) (*Dialect, error) {
+	for _, d := range dialects {
+		if strings.EqualFold(d.Name, name) {
+			return d, nil
+		}
+	}
+	return nil, fmt.Errorf("%w '%s'", ErrUnknownDialect, name)
+}
+
+// DialectNames returns the names of all known dialects.
+func DialectNames() []string {
+	names := make([]string, len(dialects))
+	for i, d := range dialects {
+		names[i] = d.Name
+	}
+	return names
+}
+
+// Mnemonic returns the name of the instruction stored in a
+// mailbox, or "???" if it is not a valid instruction. A nil
+// dialect is the same as OG.
+func (d *Dialect) Mnemonic(instr int) string {
+	if d == nil {
+		d = OG
+	}
+	key := instr / 100 * 100
+	if instr/100 == 9 {
+		key = instr
+	}
+	if name, ok := d.Names[key]; ok {
+		return name
+	}
+	return "???"
+}
@@ -0,0 +1,93 @@
+package lmc
+
+import "errors"
+import "strings"
+import "testing"
+import "github.com/stretchr/testify/assert"
+
+const higginsonCode = `
+	INP
+	STA	x
+	OUT
+	OTC
+	SUB	ten
+	SUB	one
+	BRP	pos
+	HLT
+pos	LDA	one
+	OUT
+	COB
+x	DAT
+ten	DAT	10
+one	DAT	1`
+
+func TestCompileDialect(t *testing.T) {
+	_, errs := Compile(strings.NewReader(higginsonCode))
+	assert.Equal(t, errs, []error{newError(2, "invalid instruction 'INP'")})
+	prog, errs := CompileDialect(strings.NewReader(higginsonCode), Higginson)
+	assert.Equal(t, len(errs), 0, "No errors in compilation")
+	assert.Equal(t, prog.Mem[:4], []int{901, 311, 902, 922})
+	assert.Equal(t, prog.Mem[10], 0)
+}
+
+func TestDialectNegativeFlag(t *testing.T) {
+	tests := []struct {
+		dialect *Dialect
+		strict  bool
+		input   int
+		output  []int
+	}{
+		// 5-10 underflows, but then 995-1 does not, which
+		// clears the flag
+		{Higginson, true, 5, []int{5, 5, 1}},
+		{Higginson, true, 25, []int{25, 25, 1}},
+		// the flag is sticky in the OG dialects, and OTC is
+		// a no-op in OG itself
+		{OGText, true, 5, []int{5, 5}},
+		{OGText, true, 25, []int{25, 25, 1}},
+		{OG, false, 5, []int{5}},
+		{OG, false, 25, []int{25, 1}},
+	}
+	for _, c := range tests {
+		prog, _ := CompileDialect(strings.NewReader(higginsonCode), Higginson)
+		vm := NewMachine(prog)
+		vm.Dialect = c.dialect
+		vm.Strict = c.strict
+		vm.Input = []int{c.input}
+		output, err := vm.Run()
+		assert.Equal(t, err, nil)
+		assert.Equal(t, output, c.output)
+	}
+}
+
+func TestDialectStrict(t *testing.T) {
+	prog, _ := CompileDialect(strings.NewReader(higginsonCode), Higginson)
+	vm := NewMachine(prog)
+	vm.Dialect = OG
+	vm.Strict = true
+	vm.Input = []int{5}
+	_, err := vm.Run()
+	assert.Equal(t, err.Error(), "line 5 (mailbox 03, OTC): illegal instruction 922")
+}
+
+func TestDialectMnemonic(t *testing.T) {
+	assert.Equal(t, OG.Mnemonic(300), "STO")
+	assert.Equal(t, Higginson.Mnemonic(300), "STA")
+	assert.Equal(t, Higginson.Mnemonic(922), "OTC")
+	assert.Equal(t, OG.Mnemonic(922), "???")
+	assert.Equal(t, OGText.Mnemonic(922), "OTC")
+	// og-text is OG plus OTC, without changing OG
+	assert.Equal(t, OGText.Mnemonic(300), "STO")
+	assert.Equal(t, len(OGText.Mnemonics), len(OG.Mnemonics)+1)
+	assert.Equal(t, len(OGText.Names), len(OG.Names)+1)
+	assert.Equal(t, (*Dialect)(nil).Mnemonic(901), "IN")
+}
+
+func TestLookupDialect(t *testing.T) {
+	d, err := LookupDialect("Higginson")
+	assert.Equal(t, d, Higginson)
+	assert.Equal(t, err, nil)
+	_, err = LookupDialect("foo")
+	assert.Equal(t, errors.Is(err, ErrUnknownDialect), true)
+	assert.Equal(t, err.Error(), "unknown dialect 'foo'")
+}
@@ -0,0 +1,77 @@
+package lmc
+
+import "context"
+
+// The machine keeps a decoded copy of each mailbox that it
+// executes, so that the opcode and address are not worked out
+// on every step. An entry is only used while the mailbox still
+// holds the word it was decoded from, so code which is written
+// to, whether by STO or by hand, is decoded again.
+type decodeCache struct {
+	geometry Geometry
+	instrs   []Instruction
+}
+
+// fetch returns the decoded instruction at pc, which has to be
+// a mailbox.
+func (c *Machine) fetch(pc int) Instruction {
+	g := c.geometry()
+	if c.slow {
+		return g.Decode(c.Mem[pc])
+	}
+	if c.cache.geometry != g || len(c.cache.instrs) != len(c.Mem) {
+		c.cache = decodeCache{g, make([]Instruction, len(c.Mem))}
+	}
+	instr := &c.cache.instrs[pc]
+	// the zero Instruction is the decoding of 0 in any geometry
+	if instr.Word != c.Mem[pc] {
+		*instr = g.Decode(c.Mem[pc])
+	}
+	return *instr
+}
+
+// fastLimit reports whether the machine can be run without
+// going through Step, which is the case when history is off
+// and the only observers are cycle limits. It returns the
+// lowest limit, or -1 if there is none.
+func (c *Machine) fastLimit() (int, bool) {
+	if c.slow || c.HistoryLimit > 0 {
+		return 0, false
+	}
+	limit := -1
+	for _, o := range c.Observers {
+		l, ok := o.(CycleLimit)
+		if !ok {
+			return 0, false
+		}
+		if limit < 0 || l.Limit < limit {
+			limit = l.Limit
+		}
+	}
+	return limit, true
+}
+
+// runFast is the same as calling Step until the machine halts,
+// with the cycle limit checked inline. The context is checked
+// every contextCheckInterval steps.
+func (c *Machine) runFast(ctx context.Context, limit int) error {
+	for i := 0; !c.Halted; i++ {
+		if i%contextCheckInterval == 0 && ctx.Err() != nil {
+			c.Halted = true
+			return CancelledError{c.Locate(c.PC), ctx.Err()}
+		}
+		pc := c.PC
+		if pc >= len(c.Mem) {
+			c.Halted = true
+			return PCOverflowError{c.Locate(pc)}
+		}
+		if limit >= 0 && c.Cycles >= limit {
+			c.Halted = true
+			return CycleLimitError{c.Locate(pc), limit}
+		}
+		if err := c.execute(pc, c.fetch(pc)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package lmc
+
+import "os"
+import "strings"
+import "testing"
+import "github.com/stretchr/testify/assert"
+
+const selfModifyingCode = `
+loop	LDA	count
+	ADD	one
+	STO	count
+hole	BR	next
+	OUT
+	HLT
+next	LDA	patch
+	STO	hole
+	BR	loop
+count	DAT	0
+one	DAT	1
+patch	DAT	509`
+
+const busyCode = `
+outer	LDA	n
+	BRZ	done
+	SUB	one
+	STO	n
+	LDA	m
+inner	SUB	one
+	BRP	inner
+	BR	outer
+done	OUT
+	HLT
+n	DAT	200
+m	DAT	500
+one	DAT	1`
+
+type fastTest struct {
+	code   string
+	a      Assembler
+	input  []int
+	limit  int
+	strict bool
+}
+
+func fastTests(t *testing.T) []fastTest {
+	between, err := os.ReadFile("../examples/BetweenAandB.txt")
+	assert.Equal(t, err, nil)
+	return []fastTest{
+		{selfModifyingCode, Assembler{}, nil, 0, false},
+		{busyCode, Assembler{}, nil, 0, false},
+		{busyCode, Assembler{}, nil, 5000, false},
+		{string(between), Assembler{}, []int{3, 5, 4}, 0, false},
+		{string(between), Assembler{}, []int{3}, 0, false},
+		{stackCode, Assembler{StackSize: 2}, []int{3, 4}, 0, true},
+		{stackCode, Assembler{StackSize: 1}, []int{3, 4}, 0, true},
+		{"\tDAT\t404", Assembler{}, nil, 0, true},
+		{"\tBR\t99", Assembler{}, nil, 0, false},
+	}
+}
+
+func TestFastMatchesSlow(t *testing.T) {
+	for _, c := range fastTests(t) {
+		prog, errs := c.a.Compile(strings.NewReader(c.code))
+		assert.Equal(t, len(errs), 0, "No errors in compilation")
+		vms := []*Machine{}
+		errors := []error{}
+		for _, slow := range []bool{true, false} {
+			vm := NewMachine(prog)
+			vm.slow = slow
+			vm.Strict = c.strict
+			vm.Input = c.input
+			if c.limit > 0 {
+				vm.Observers = []Observer{CycleLimit{c.limit}}
+			}
+			_, err := vm.Run()
+			vms = append(vms, vm)
+			errors = append(errors, err)
+		}
+		slow, fast := vms[0], vms[1]
+		assert.Equal(t, errors[1], errors[0], c.code)
+		assert.Equal(t, fast.Mem, slow.Mem, c.code)
+		assert.Equal(t, fast.Snapshot(), slow.Snapshot(), c.code)
+		assert.Equal(t, fast.Last, slow.Last, c.code)
+	}
+}
+
+func TestFastSelfModifyingCode(t *testing.T) {
+	prog, errs := Compile(strings.NewReader(selfModifyingCode))
+	assert.Equal(t, len(errs), 0, "No errors in compilation")
+	vm := NewMachine(prog)
+	vm.Observers = []Observer{CycleLimit{100}}
+	output, err := vm.Run()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, output, []int{2})
+	// the cache also notices writes made by hand
+	vm.Restore()
+	vm.Mem[3] = 509
+	output, err = vm.Run()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, output, []int{1})
+}
+
+func benchmarkRun(b *testing.B, slow bool) {
+	prog, _ := Compile(strings.NewReader(busyCode))
+	vm := NewMachine(prog)
+	vm.slow = slow
+	vm.Observers = []Observer{CycleLimit{1000000}}
+	for i := 0; i < b.N; i++ {
+		vm.Restore()
+		if _, err := vm.Run(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRunSlow(b *testing.B) { benchmarkRun(b, true) }
+func BenchmarkRunFast(b *testing.B) { benchmarkRun(b, false) }
+
+func benchmarkTestCases(b *testing.B, slow bool) {
+	prog, _ := Compile(strings.NewReader(busyCode))
+	vm := NewMachine(prog)
+	vm.slow = slow
+	cases := make([]TestCase, 20)
+	for i := range cases {
+		cases[i] = TestCase{"a", nil, []int{0}, 1000000, nil}
+	}
+	for i := 0; i < b.N; i++ {
+		RunTestCases(4, vm, cases)
+	}
+}
+
+func BenchmarkTestCasesSlow(b *testing.B) { benchmarkTestCases(b, true) }
+func BenchmarkTestCasesFast(b *testing.B) { benchmarkTestCases(b, false) }
@@ -0,0 +1,116 @@
+package lmc
+
+import "errors"
+import "fmt"
+import "strconv"
+import "strings"
+
+// ErrInvalidGeometry is returned when a geometry cannot be
+// parsed or does not make sense.
+var ErrInvalidGeometry error = errors.New("invalid geometry")
+
+// Geometry is the size of a machine: the number of mailboxes
+// and the number of digits in a word. A word is an opcode digit
+// followed by an address, so 3 digit words can address at most
+// 100 mailboxes and 4 digit words at most 1000. Opcodes keep
+// their meaning: IN is 901 with 3 digits and 9001 with 4.
+type Geometry struct {
+	Mailboxes int `json:"mailboxes"`
+	Digits    int `json:"digits"`
+}
+
+// Standard is the geometry of the OG machine.
+var Standard = Geometry{Mailboxes: 100, Digits: 3}
+
+// ParseGeometry parses a geometry of the form "1000x4", i.e.
+// the number of mailboxes and the number of digits in a word.
+func ParseGeometry(s string) (Geometry, error) {
+	parts := strings.SplitN(s, "x", 2)
+	if len(parts) != 2 {
+		return Geometry{}, fmt.Errorf("%w '%s', expected e.g. 1000x4", ErrInvalidGeometry, s)
+	}
+	mailboxes, err1 := strconv.Atoi(parts[0])
+	digits, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil {
+		return Geometry{}, fmt.Errorf("%w '%s', expected e.g. 1000x4", ErrInvalidGeometry, s)
+	}
+	g := Geometry{mailboxes, digits}
+	return g, g.Validate()
+}
+
+func (g Geometry) String() string {
+	return fmt.Sprintf("%dx%d", g.Mailboxes, g.Digits)
+}
+
+// Validate checks that every mailbox can be addressed.
+func (g Geometry) Validate() error {
+	// 922 needs an address of at least 2 digits, and anything
+	// past 9 digits overflows on 32 bit platforms
+	if g.Digits < 3 || g.Digits > 9 {
+		return fmt.Errorf("%w %s: words must have 3-9 digits", ErrInvalidGeometry, g)
+	}
+	if g.Mailboxes < 1 || g.Mailboxes > g.scale() {
+		return fmt.Errorf("%w %s: %d digit words need 1-%d mailboxes", ErrInvalidGeometry, g, g.Digits, g.scale())
+	}
+	return nil
+}
+
+// orStandard returns Standard for the zero geometry.
+func (g Geometry) orStandard() Geometry {
+	if g == (Geometry{}) {
+		return Standard
+	}
+	return g
+}
+
+// scale is what the opcode is multiplied by, e.g. 100.
+func (g Geometry) scale() int {
+	n := 1
+	for i := 1; i < g.Digits; i++ {
+		n *= 10
+	}
+	return n
+}
+
+// Max returns the largest value that fits in a mailbox.
+func (g Geometry) Max() int {
+	return g.scale()*10 - 1
+}
+
+// AddrWidth returns the number of digits in an address.
+func (g Geometry) AddrWidth() int {
+	return g.Digits - 1
+}
+
+// Decode splits a mailbox into its opcode and address.
+func (g Geometry) Decode(word int) Instruction {
+	return Instruction{word, word / g.scale(), word % g.scale()}
+}
+
+// encode converts an opcode from the dialect, which is always
+// written with 3 digits, to this geometry.
+func (g Geometry) encode(op int) int {
+	return op/100*g.scale() + op%100
+}
+
+// standard is the reverse of encode. It returns false if the
+// word has no 3 digit equivalent.
+func (g Geometry) standard(word int) (int, bool) {
+	if word < 0 || word > g.Max() {
+		return 0, false
+	}
+	i := g.Decode(word)
+	if i.Opcode != 9 {
+		return i.Opcode * 100, true
+	}
+	if i.Addr > 99 {
+		return 0, false
+	}
+	return 900 + i.Addr, true
+}
+
+// ParseInputs is like the package level ParseInputs, but
+// accepts any value that fits in a mailbox.
+func (g Geometry) ParseInputs(strs []string) ([]int, error) {
+	return parseValues(strs, g.Max())
+}
@@ -0,0 +1,114 @@
+package lmc
+
+import "errors"
+import "fmt"
+import "strings"
+import "testing"
+import "github.com/stretchr/testify/assert"
+
+func TestParseGeometry(t *testing.T) {
+	tests := []struct {
+		s   string
+		g   Geometry
+		err bool
+	}{
+		{"100x3", Standard, false},
+		{"1000x4", Geometry{1000, 4}, false},
+		{"50x3", Geometry{50, 3}, false},
+		{"1000x3", Geometry{1000, 3}, true},
+		{"10x2", Geometry{10, 2}, true},
+		{"0x3", Geometry{0, 3}, true},
+		{"100", Geometry{}, true},
+		{"ax3", Geometry{}, true},
+	}
+	for _, c := range tests {
+		g, err := ParseGeometry(c.s)
+		assert.Equal(t, g, c.g, c.s)
+		assert.Equal(t, err != nil, c.err, c.s)
+		if err != nil {
+			assert.Equal(t, errors.Is(err, ErrInvalidGeometry), true, c.s)
+		}
+	}
+}
+
+func TestCompileGeometry(t *testing.T) {
+	code := `
+	IN
+	ADD	x
+	STO	500
+	OTC
+	OUT
+	HLT
+x	DAT	9990`
+	_, errs := Compile(strings.NewReader(code))
+	assert.Equal(t, errs, []error{newError(4, "invalid address/label: 500")})
+	a := Assembler{Dialect: OGText, Geometry: Geometry{1000, 4}}
+	prog, errs := a.Compile(strings.NewReader(code))
+	assert.Equal(t, len(errs), 0, "No errors in compilation")
+	assert.Equal(t, len(prog.Mem), 1000)
+	assert.Equal(t, prog.Mem[:7], []int{9001, 1006, 3500, 9022, 9002, 0, 9990})
+	vm := NewMachine(prog)
+	vm.Input = []int{15}
+	output, err := vm.Run()
+	assert.Equal(t, err, nil)
+	// 15 + 9990 wraps around at 10000
+	assert.Equal(t, output, []int{5, 5})
+	assert.Equal(t, vm.Channels, []Channel{Char, Numeric})
+	assert.Equal(t, vm.Mem[500], 5)
+	assert.Equal(t, vm.Locate(2).Mnemonic, "STO")
+	assert.Equal(t, vm.Locate(2).String(), "line 4 (mailbox 002, STO)")
+	assert.Equal(t, vm.Locate(700).String(), "mailbox 700 (0000, HLT)")
+
+	_, errs = a.Compile(strings.NewReader("\tDAT\t10000"))
+	assert.Equal(t, len(errs), 1)
+	_, errs = a.Compile(strings.NewReader("\tBR\t1000"))
+	assert.Equal(t, errs, []error{newError(1, "invalid address/label: 1000")})
+}
+
+func TestCompileMailboxLimit(t *testing.T) {
+	code := strings.Repeat("\tHLT\n", 100)
+	prog, errs := Compile(strings.NewReader(code))
+	assert.Equal(t, len(errs), 0)
+	assert.Equal(t, prog.Size(), 100)
+	_, errs = Compile(strings.NewReader(code + "\tHLT\n"))
+	assert.Equal(t, errs, []error{newError(101, "out of mailboxes")})
+	a := Assembler{Geometry: Geometry{50, 3}}
+	_, errs = a.Compile(strings.NewReader(code))
+	assert.Equal(t, errs, []error{newError(51, "out of mailboxes")})
+}
+
+func TestAddressOutOfRange(t *testing.T) {
+	// 3 digit words can address mailboxes past the last one
+	a := Assembler{Geometry: Geometry{50, 3}}
+	prog, errs := a.Compile(strings.NewReader("\tLDA\tx\nx\tDAT\t399"))
+	assert.Equal(t, len(errs), 0)
+	vm := NewMachine(prog)
+	vm.PC = 1
+	_, err := vm.Run()
+	assert.Equal(t, err, AddressError{vm.Locate(1), 99})
+	assert.Equal(t, err.Error(), "line 2 (mailbox 01, DAT): mailbox 99 is out of range")
+	assert.Equal(t, vm.Halted, true)
+}
+
+func TestIllegalInstructionDigits(t *testing.T) {
+	a := Assembler{Geometry: Geometry{1000, 4}}
+	prog, errs := a.Compile(strings.NewReader("\tDAT\t4005"))
+	assert.Equal(t, len(errs), 0)
+	vm := NewMachine(prog)
+	vm.Strict = true
+	_, err := vm.Run()
+	assert.Equal(t, err.Error(), "line 1 (mailbox 000, DAT): illegal instruction 4005")
+}
+
+func TestGeometryInputs(t *testing.T) {
+	g := Geometry{1000, 4}
+	values, err := g.ParseInputs([]string{"9999", "0"})
+	assert.Equal(t, values, []int{9999, 0})
+	assert.Equal(t, err, nil)
+	_, err = ParseInputs([]string{"9999"})
+	assert.Equal(t, err, fmt.Errorf("cannot convert '9999' to int: number not in range 0-999"))
+	b, errs := ParseBatch(strings.NewReader("!geometry 1000x4\na;9999;9999;10"))
+	assert.Equal(t, len(errs), 0)
+	assert.Equal(t, b.Geometry, g)
+	assert.Equal(t, b.Cases[0].Input, []int{9999})
+}
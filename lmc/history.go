@@ -0,0 +1,102 @@
+package lmc
+
+import "errors"
+
+// ErrNoHistory is returned by StepBack when there are no more
+// steps to undo.
+var ErrNoHistory = errors.New("no more history")
+
+// undo holds everything needed to reverse a single step.
+type undo struct {
+	pc     int
+	acc    int
+	neg    bool
+	sp     int
+	halted bool
+	cycles int
+	read   int
+	addr   int // mailbox written, or -1
+	old    int // previous value of the mailbox
+	input  bool
+	value  int // value consumed by IN
+	output bool
+	set    bool // made by Set rather than by a step
+}
+
+// record pushes the current state onto the undo log.
+func (c *Machine) record() {
+	for len(c.history) >= c.HistoryLimit {
+		c.history = c.history[1:]
+	}
+	c.history = append(c.history, undo{
+		pc:     c.PC,
+		acc:    c.Acc,
+		neg:    c.Neg,
+		sp:     c.SP,
+		halted: c.Halted,
+		cycles: c.Cycles,
+		read:   c.read,
+		addr:   -1,
+	})
+}
+
+// last returns the undo entry for the step being executed,
+// or nil if history is not being recorded.
+func (c *Machine) last() *undo {
+	if c.HistoryLimit == 0 || len(c.history) == 0 {
+		return nil
+	}
+	return &c.history[len(c.history)-1]
+}
+
+// History returns the number of steps that can be undone.
+func (c *Machine) History() int {
+	return len(c.history)
+}
+
+// StepBack undoes the last step. Values consumed by IN are
+// given back to the machine, but values already sent to Out
+// cannot be taken back. Observers which implement Rewinder are
+// rewound along with the machine.
+func (c *Machine) StepBack() error {
+	if len(c.history) == 0 {
+		return ErrNoHistory
+	}
+	u := c.history[len(c.history)-1]
+	c.history = c.history[:len(c.history)-1]
+	if u.addr >= 0 {
+		c.Mem[u.addr] = u.old
+	}
+	if u.input {
+		c.pending = append([]int{u.value}, c.pending...)
+	}
+	if u.output {
+		c.Output = c.Output[:len(c.Output)-1]
+		c.Channels = c.Channels[:len(c.Channels)-1]
+	}
+	c.PC = u.pc
+	c.Acc = u.acc
+	c.Neg = u.neg
+	c.SP = u.sp
+	c.Halted = u.halted
+	c.Cycles = u.cycles
+	c.read = u.read
+	for _, o := range c.Observers {
+		if r, ok := o.(Rewinder); ok {
+			r.Rewind(c.Cycles)
+		}
+	}
+	return nil
+}
+
+// LastWrite returns the mailbox holding the instruction which
+// last wrote to the given mailbox, and the cycle it happened in.
+func (c *Machine) LastWrite(mailbox int) (pc int, cycle int, ok bool) {
+	for i := len(c.history) - 1; i >= 0; i-- {
+		u := c.history[i]
+		if u.addr == mailbox && !u.set {
+			return u.pc, u.cycles + 1, true
+		}
+	}
+	return 0, 0, false
+}
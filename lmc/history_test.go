@@ -0,0 +1,57 @@
+package lmc
+
+import "strings"
+import "testing"
+import "github.com/stretchr/testify/assert"
+
+func TestStepBack(t *testing.T) {
+	r := strings.NewReader(`
+	IN
+	STO	x
+	OUT
+	HLT
+x	DAT	5`)
+	prog, errs := Compile(r)
+	assert.Equal(t, len(errs), 0, "No errors in compilation")
+	vm := NewMachine(prog)
+	vm.HistoryLimit = 10
+	vm.In = NewSliceInput([]int{7})
+	output, err := vm.Run()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, output, []int{7})
+	assert.Equal(t, vm.History(), 4)
+	pc, cycle, ok := vm.LastWrite(4)
+	assert.Equal(t, []interface{}{pc, cycle, ok}, []interface{}{1, 2, true})
+	_, _, ok = vm.LastWrite(3)
+	assert.Equal(t, ok, false)
+	// undo everything
+	for vm.StepBack() == nil {
+	}
+	assert.Equal(t, vm.PC, 0)
+	assert.Equal(t, vm.Acc, 0)
+	assert.Equal(t, vm.Cycles, 0)
+	assert.Equal(t, vm.Halted, false)
+	assert.Equal(t, vm.Mem[4], 5)
+	assert.Equal(t, vm.Output, []int{})
+	assert.Equal(t, len(vm.Channels), 0)
+	assert.Equal(t, vm.StepBack(), ErrNoHistory)
+	// consumed input is given back
+	output, err = vm.Run()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, output, []int{7})
+}
+
+func TestHistoryLimit(t *testing.T) {
+	r := strings.NewReader(`
+loop	BR	loop`)
+	prog, errs := Compile(r)
+	assert.Equal(t, len(errs), 0, "No errors in compilation")
+	vm := NewMachine(prog)
+	vm.HistoryLimit = 3
+	for i := 0; i < 10; i++ {
+		vm.Step()
+	}
+	assert.Equal(t, vm.History(), 3)
+	vm.StepBack()
+	assert.Equal(t, vm.Cycles, 9)
+}
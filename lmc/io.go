@@ -0,0 +1,217 @@
+package lmc
+
+import "io"
+import "os"
+import "fmt"
+import "bufio"
+import "strings"
+import "strconv"
+
+// InputSource is where the machine gets its values from when
+// executing IN. Read should return io.EOF or ErrNoMoreInput
+// once there are no more values.
+type InputSource interface {
+	Read() (int, error)
+}
+
+// OutputSink is where the machine sends its values to when
+// executing OUT.
+type OutputSink interface {
+	Write(int) error
+}
+
+// SliceInput reads values from a slice.
+type SliceInput struct {
+	values []int
+}
+
+func NewSliceInput(values []int) *SliceInput {
+	return &SliceInput{values}
+}
+
+func (s *SliceInput) Read() (int, error) {
+	if len(s.values) == 0 {
+		return 0, ErrNoMoreInput
+	}
+	n := s.values[0]
+	s.values = s.values[1:]
+	return n, nil
+}
+
+// ReaderInput reads whitespace separated values from a reader.
+type ReaderInput struct {
+	Max     int // largest value accepted, 999 by default
+	scanner *bufio.Scanner
+	closer  io.Closer
+}
+
+func NewReaderInput(r io.Reader) *ReaderInput {
+	scanner := bufio.NewScanner(r)
+	scanner.Split(bufio.ScanWords)
+	return &ReaderInput{Max: 999, scanner: scanner}
+}
+
+// OpenInputFile returns a ReaderInput which reads from the
+// file at path. The file is closed by calling Close.
+func OpenInputFile(path string) (*ReaderInput, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := NewReaderInput(fp)
+	r.closer = fp
+	return r, nil
+}
+
+func (r *ReaderInput) Read() (int, error) {
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return 0, err
+		}
+		return 0, io.EOF
+	}
+	s := r.scanner.Text()
+	n, err := stoi(s, r.Max)
+	if err != nil {
+		return 0, fmt.Errorf("cannot convert '%s' to int: %s", s, err)
+	}
+	return n, nil
+}
+
+func (r *ReaderInput) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// PromptInput asks for a value on each read, like the OG
+// simulator does. Invalid values are asked for again.
+type PromptInput struct {
+	Max    int // largest value accepted, 999 by default
+	reader *bufio.Reader
+	w      io.Writer
+	prompt string
+}
+
+func NewPromptInput(r io.Reader, w io.Writer, prompt string) *PromptInput {
+	return &PromptInput{999, bufio.NewReader(r), w, prompt}
+}
+
+func (p *PromptInput) Read() (int, error) {
+	for {
+		fmt.Fprint(p.w, p.prompt)
+		s, err := p.reader.ReadString('\n')
+		s = strings.TrimSpace(s)
+		if err != nil && s == "" {
+			return 0, err
+		}
+		n, convErr := stoi(s, p.Max)
+		if convErr == nil {
+			return n, nil
+		}
+		fmt.Fprintf(p.w, "cannot convert '%s' to int: %s\n", s, convErr)
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// ChanInput receives values from a channel. Closing the
+// channel signals that there are no more values.
+type ChanInput <-chan int
+
+func (c ChanInput) Read() (int, error) {
+	n, ok := <-c
+	if !ok {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// Channel is the kind of value written by the machine.
+type Channel int
+
+const (
+	Numeric Channel = iota // written by OUT
+	Char                   // character code written by OTC
+)
+
+// FormatOutput formats the output for display: numbers are
+// separated by commas, and runs of characters are quoted, e.g.
+// `"HI", 5`. Values without a channel are numbers.
+func FormatOutput(output []int, channels []Channel) string {
+	parts := []string{}
+	text := []rune{}
+	for i, n := range output {
+		if i < len(channels) && channels[i] == Char {
+			text = append(text, rune(n))
+			continue
+		}
+		if len(text) > 0 {
+			parts = append(parts, strconv.Quote(string(text)))
+			text = text[:0]
+		}
+		parts = append(parts, strconv.Itoa(n))
+	}
+	if len(text) > 0 {
+		parts = append(parts, strconv.Quote(string(text)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ChannelSink is implemented by output sinks which show
+// characters differently from numbers. The machine uses it
+// instead of Write when it is available.
+type ChannelSink interface {
+	WriteChannel(n int, ch Channel) error
+}
+
+// SliceOutput collects values into a slice.
+type SliceOutput struct {
+	Values []int
+}
+
+func (s *SliceOutput) Write(n int) error {
+	s.Values = append(s.Values, n)
+	return nil
+}
+
+// WriterOutput writes each number on its own line as soon as
+// it is produced. Characters are written as they are.
+type WriterOutput struct {
+	w    io.Writer
+	text bool // in the middle of a line of characters
+}
+
+func NewWriterOutput(w io.Writer) *WriterOutput {
+	return &WriterOutput{w: w}
+}
+
+func (w *WriterOutput) Write(n int) error {
+	return w.WriteChannel(n, Numeric)
+}
+
+func (w *WriterOutput) WriteChannel(n int, ch Channel) (err error) {
+	if ch == Char {
+		_, err = fmt.Fprintf(w.w, "%c", rune(n))
+		w.text = n != '\n'
+		return
+	}
+	if w.text {
+		w.text = false
+		if _, err = fmt.Fprintln(w.w); err != nil {
+			return
+		}
+	}
+	_, err = fmt.Fprintln(w.w, n)
+	return
+}
+
+// ChanOutput sends values down a channel.
+type ChanOutput chan<- int
+
+func (c ChanOutput) Write(n int) error {
+	c <- n
+	return nil
+}
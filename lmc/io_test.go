@@ -0,0 +1,76 @@
+package lmc
+
+import "io"
+import "bytes"
+import "errors"
+import "strings"
+import "testing"
+import "github.com/stretchr/testify/assert"
+
+func TestReaderInput(t *testing.T) {
+	in := NewReaderInput(strings.NewReader("1 2\n3\n\nabc"))
+	for _, x := range []int{1, 2, 3} {
+		n, err := in.Read()
+		assert.Equal(t, err, nil)
+		assert.Equal(t, n, x)
+	}
+	_, err := in.Read()
+	assert.Equal(t, err != nil, true)
+	_, err = in.Read()
+	assert.Equal(t, err, io.EOF)
+}
+
+func TestPromptInput(t *testing.T) {
+	w := &bytes.Buffer{}
+	in := NewPromptInput(strings.NewReader("12\nabc\n5"), w, "> ")
+	n, err := in.Read()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, n, 12)
+	// invalid values are asked for again
+	n, err = in.Read()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, n, 5)
+	_, err = in.Read()
+	assert.Equal(t, err, io.EOF)
+	assert.Equal(t, w.String(), "> > cannot convert 'abc' to int: strconv.Atoi: parsing \"abc\": invalid syntax\n> > ")
+}
+
+func TestVMDevices(t *testing.T) {
+	r := strings.NewReader(`
+loop	IN
+	OUT
+	BR	loop`)
+	prog, errs := Compile(r)
+	assert.Equal(t, len(errs), 0, "No errors in compilation")
+	in := make(chan int, 3)
+	out := make(chan int, 3)
+	in <- 7
+	in <- 8
+	close(in)
+	vm := NewMachine(prog)
+	vm.In = ChanInput(in)
+	vm.Out = ChanOutput(out)
+	output, err := vm.Run()
+	assert.Equal(t, errors.Is(err, ErrNoMoreInput), true)
+	assert.Equal(t, output, []int{7, 8})
+	assert.Equal(t, []int{<-out, <-out}, []int{7, 8})
+	// writers get each value as it is produced
+	w := &bytes.Buffer{}
+	vm.Restore()
+	vm.In = NewSliceInput([]int{1, 2, 3})
+	vm.Out = NewWriterOutput(w)
+	vm.Run()
+	assert.Equal(t, w.String(), "1\n2\n3\n")
+}
+
+func TestWriterOutputText(t *testing.T) {
+	w := &bytes.Buffer{}
+	out := NewWriterOutput(w)
+	out.WriteChannel('H', Char)
+	out.WriteChannel('I', Char)
+	out.Write(5)
+	out.WriteChannel('!', Char)
+	out.WriteChannel('\n', Char)
+	out.Write(6)
+	assert.Equal(t, w.String(), "HI\n5\n!\n6\n")
+}
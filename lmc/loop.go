@@ -0,0 +1,100 @@
+package lmc
+
+import "errors"
+import "fmt"
+
+// ErrInfiniteLoop is wrapped by InfiniteLoopError.
+var ErrInfiniteLoop = errors.New("infinite loop")
+
+// InfiniteLoopError is returned when the machine reaches a
+// state it has already been in, which means it will never
+// halt.
+type InfiniteLoopError struct {
+	Location
+	Since int // cycle at which the state was first seen
+}
+
+func (e InfiniteLoopError) Error() string {
+	return fmt.Sprintf("%s: infinite loop detected at %s after %d cycles", e.Location, e.mailbox(e.PC), e.Cycles)
+}
+
+func (e InfiniteLoopError) Unwrap() error { return ErrInfiniteLoop }
+
+// maximum number of states remembered by a LoopDetector; once
+// reached, the detector starts afresh so only loops longer
+// than this go unnoticed.
+const maxLoopStates = 1 << 20
+
+// LoopDetector stops the machine with an InfiniteLoopError
+// once it sees the same machine state twice. The state is
+// made up of the pc, acc, neg flag, memory, and the number of
+// inputs consumed, which since inputs are only ever consumed
+// means the remaining input is the same too. States are
+// compared by their hash. Port devices such as the RNG keep
+// state of their own, so the detector does nothing on
+// machines with ports attached.
+type LoopDetector struct {
+	seen map[uint64]int // by hash, to the cycle it was seen in
+}
+
+func NewLoopDetector() *LoopDetector {
+	return &LoopDetector{seen: map[uint64]int{}}
+}
+
+func (d *LoopDetector) Reset() {
+	d.seen = map[uint64]int{}
+}
+
+func (d *LoopDetector) Rewind(cycles int) {
+	// the state at cycles is about to be seen again
+	for h, since := range d.seen {
+		if since >= cycles {
+			delete(d.seen, h)
+		}
+	}
+}
+
+func (d *LoopDetector) Clone() Observer {
+	return NewLoopDetector()
+}
+
+// hash returns the FNV-1a hash of the state of the machine.
+func (c *Machine) hash() uint64 {
+	h := uint64(14695981039346656037)
+	mix := func(n int) {
+		h ^= uint64(n)
+		h *= 1099511628211
+	}
+	mix(c.PC)
+	mix(c.Acc)
+	if c.Neg {
+		mix(1)
+	} else {
+		mix(0)
+	}
+	mix(c.read)
+	mix(c.SP)
+	for _, m := range c.Mem {
+		mix(m)
+	}
+	return h
+}
+
+func (d *LoopDetector) BeforeStep(m *Machine, pc int, instr Instruction) error {
+	if len(m.ports) > 0 {
+		return nil
+	}
+	if len(d.seen) >= maxLoopStates {
+		d.Reset()
+	}
+	h := m.hash()
+	if since, ok := d.seen[h]; ok {
+		return InfiniteLoopError{m.Locate(pc), since}
+	}
+	d.seen[h] = m.Cycles
+	return nil
+}
+
+func (d *LoopDetector) AfterStep(m *Machine, e Effect) error {
+	return nil
+}
@@ -0,0 +1,97 @@
+package lmc
+
+import "errors"
+import "strings"
+import "testing"
+import "github.com/stretchr/testify/assert"
+
+func TestLoopDetector(t *testing.T) {
+	r := strings.NewReader(`
+	IN
+loop	SUB	one
+	BRP	loop
+	LDA	x
+	OUT
+wait	BR	wait
+one	DAT	1
+x	DAT	3`)
+	prog, errs := Compile(r)
+	assert.Equal(t, len(errs), 0, "No errors in compilation")
+	vm := NewMachine(prog)
+	vm.Observers = []Observer{NewLoopDetector()}
+	vm.Input = []int{3}
+	output, err := vm.Run()
+	// the countdown loop should not be mistaken for an
+	// infinite loop, only the final one
+	assert.Equal(t, output, []int{3})
+	assert.Equal(t, errors.Is(err, ErrInfiniteLoop), true)
+	assert.Equal(t, err.Error(), "line 7 (mailbox 05, BR): infinite loop detected at mailbox 05 after 12 cycles")
+	assert.Equal(t, err.(InfiniteLoopError).Since, 11)
+	// restoring the machine forgets the states seen
+	vm.Restore()
+	vm.Input = []int{3}
+	output, err = vm.Run()
+	assert.Equal(t, output, []int{3})
+	assert.Equal(t, err.(InfiniteLoopError).Since, 11)
+}
+
+func TestLoopDetectorBatch(t *testing.T) {
+	r := strings.NewReader(`
+	IN
+	BRZ	loop
+	OUT
+	HLT
+loop	BR	loop`)
+	prog, errs := Compile(r)
+	assert.Equal(t, len(errs), 0, "No errors in compilation")
+	vm := NewMachine(prog)
+	vm.Observers = []Observer{NewLoopDetector()}
+	cases := []TestCase{}
+	for i := 0; i < 20; i++ {
+		cases = append(cases, TestCase{"a", []int{i % 2}, []int{1}, 100, nil})
+	}
+	for i, res := range RunTestCases(4, vm, cases) {
+		if i%2 == 0 {
+			assert.Equal(t, res.Status(), StatusInfiniteLoop)
+			assert.Equal(t, res.Cycles, 3)
+		} else {
+			assert.Equal(t, res.Status(), StatusPassed)
+		}
+	}
+}
+
+func TestLoopDetectorPorts(t *testing.T) {
+	// the state only changes inside the rng, so the machine
+	// looks like it is looping
+	vm := compileWithDevices(t, `
+loop	RND
+	SUB	k
+	BRZ	done
+	BR	loop
+done	HLT
+k	DAT	7`, NewRNG(1))
+	vm.Observers = []Observer{NewLoopDetector(), CycleLimit{100000}}
+	_, err := vm.Run()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, vm.Halted, true)
+}
+
+func TestLoopDetectorStepBack(t *testing.T) {
+	prog, errs := Compile(strings.NewReader(`
+	LDA	x
+	OUT
+	HLT
+x	DAT	1`))
+	assert.Equal(t, len(errs), 0, "No errors in compilation")
+	vm := NewMachine(prog)
+	vm.HistoryLimit = 10
+	vm.Observers = []Observer{NewLoopDetector()}
+	// going over the same steps again is not a loop
+	assert.Equal(t, vm.Step(), nil)
+	assert.Equal(t, vm.Step(), nil)
+	assert.Equal(t, vm.StepBack(), nil)
+	assert.Equal(t, vm.StepBack(), nil)
+	output, err := vm.Run()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, output, []int{1})
+}
@@ -0,0 +1,269 @@
+package lmc
+
+import "bufio"
+import "context"
+import "errors"
+import "fmt"
+import "io"
+import "sort"
+import "strconv"
+import "strings"
+
+// ErrDeadlock is wrapped by DeadlockError.
+var ErrDeadlock = errors.New("deadlock")
+
+// A Network runs several machines together, with the OUT of one
+// machine wired to the IN of others over buffered channels. The
+// machines are stepped in turn, in the order that they were
+// added, so a run is deterministic. A machine waiting on IN with
+// an empty channel, or on OUT with a full channel, is blocked
+// and skipped until the channel is ready.
+type Network struct {
+	Nodes []*Node
+}
+
+// Node is a machine in a network.
+type Node struct {
+	Name string
+	VM   *Machine
+	// Err is the error that stopped the machine, if any.
+	Err  error
+	in   chan int
+	outs []chan int
+}
+
+// Blocked returns "IN" or "OUT" if the machine is waiting on a
+// channel, or "" if it is free to run.
+func (n *Node) Blocked() string {
+	vm := n.VM
+	if vm.Halted || vm.PC < 0 || vm.PC >= len(vm.Mem) {
+		return ""
+	}
+	std, _ := vm.geometry().standard(vm.Mem[vm.PC])
+	switch {
+	case std == 901 && n.in != nil && len(n.in) == 0 && len(vm.pending) == 0:
+		return "IN"
+	case std == 902 || (std == 922 && vm.dialect().OTC):
+		for _, ch := range n.outs {
+			if len(ch) == cap(ch) {
+				return "OUT"
+			}
+		}
+	}
+	return ""
+}
+
+// chanInput reads from a channel which is known to be ready.
+type chanInput chan int
+
+func (c chanInput) Read() (int, error) {
+	return <-c, nil
+}
+
+// chanOutput writes to channels which are known to be ready.
+type chanOutput []chan int
+
+func (c chanOutput) Write(n int) error {
+	for _, ch := range c {
+		ch <- n
+	}
+	return nil
+}
+
+func (n *Network) node(name string) *Node {
+	for _, node := range n.Nodes {
+		if node.Name == name {
+			return node
+		}
+	}
+	return nil
+}
+
+// Add adds a machine to the network. Machines without an input
+// link read from their Input or In as usual.
+func (n *Network) Add(name string, vm *Machine) error {
+	if n.node(name) != nil {
+		return fmt.Errorf("machine '%s' already exists", name)
+	}
+	n.Nodes = append(n.Nodes, &Node{Name: name, VM: vm})
+	return nil
+}
+
+// Connect wires the OUT of one machine to the IN of another,
+// over a channel which holds up to size values. A machine can
+// only have one input link, and cannot have an input link as
+// well as its own Input or In, but it can have many output
+// links, in which case each value is sent to all of them.
+func (n *Network) Connect(from string, to string, size int) error {
+	src, dst := n.node(from), n.node(to)
+	switch {
+	case src == nil:
+		return fmt.Errorf("unknown machine '%s'", from)
+	case dst == nil:
+		return fmt.Errorf("unknown machine '%s'", to)
+	case dst.in != nil:
+		return fmt.Errorf("machine '%s' already has an input link", to)
+	case len(dst.VM.Input) > 0 || dst.VM.In != nil:
+		return fmt.Errorf("machine '%s' already has input", to)
+	case size < 1:
+		return fmt.Errorf("invalid buffer size %d", size)
+	}
+	ch := make(chan int, size)
+	dst.in = ch
+	dst.VM.In = chanInput(ch)
+	src.outs = append(src.outs, ch)
+	src.VM.Out = chanOutput(src.outs)
+	return nil
+}
+
+// DeadlockError is returned by Network.Run when none of the
+// machines which are still running can make progress.
+type DeadlockError struct {
+	Blocked map[string]string // name => "IN" or "OUT"
+	Rounds  int
+}
+
+func (e DeadlockError) Error() string {
+	names := []string{}
+	for name := range e.Blocked {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	waits := []string{}
+	for _, name := range names {
+		waits = append(waits, fmt.Sprintf("%s on %s", name, e.Blocked[name]))
+	}
+	return fmt.Sprintf("deadlock after %d rounds: %s", e.Rounds, strings.Join(waits, ", "))
+}
+
+func (e DeadlockError) Unwrap() error { return ErrDeadlock }
+
+// Run steps each machine in turn until they have all halted. A
+// machine which stops with an error is left halted, and its
+// error is kept in Err. Run returns a DeadlockError if the
+// remaining machines are all blocked, and the error of the
+// context if it is done first.
+func (n *Network) Run(ctx context.Context) error {
+	for round := 0; ; round++ {
+		if round%contextCheckInterval == 0 && ctx.Err() != nil {
+			return fmt.Errorf("stopped after %d rounds: %w", round, ctx.Err())
+		}
+		progress := false
+		blocked := map[string]string{}
+		for _, node := range n.Nodes {
+			if node.VM.Halted {
+				continue
+			}
+			if wait := node.Blocked(); wait != "" {
+				blocked[node.Name] = wait
+				continue
+			}
+			progress = true
+			if err := node.VM.Step(); err != nil {
+				node.VM.Halted = true
+				node.Err = err
+			}
+		}
+		if !progress {
+			if len(blocked) > 0 {
+				return DeadlockError{blocked, round}
+			}
+			return nil
+		}
+	}
+}
+
+// NetworkMachine is a machine in a NetworkConfig.
+type NetworkMachine struct {
+	Name  string
+	Path  string
+	Input []int
+}
+
+// NetworkLink is a link in a NetworkConfig.
+type NetworkLink struct {
+	From string
+	To   string
+	Size int
+}
+
+// NetworkConfig is a parsed network file.
+type NetworkConfig struct {
+	Machines []NetworkMachine
+	Links    []NetworkLink
+}
+
+func (c *NetworkConfig) machine(name string) *NetworkMachine {
+	for i := range c.Machines {
+		if c.Machines[i].Name == name {
+			return &c.Machines[i]
+		}
+	}
+	return nil
+}
+
+func (c *NetworkConfig) parseLine(fields []string, g Geometry) error {
+	switch {
+	case fields[0] == "machine" && len(fields) == 3:
+		if c.machine(fields[1]) != nil {
+			return fmt.Errorf("machine '%s' already exists", fields[1])
+		}
+		c.Machines = append(c.Machines, NetworkMachine{Name: fields[1], Path: fields[2]})
+		return nil
+	case fields[0] == "link" && len(fields) == 4:
+		for _, name := range fields[1:3] {
+			if c.machine(name) == nil {
+				return fmt.Errorf("unknown machine '%s'", name)
+			}
+		}
+		size, err := strconv.Atoi(fields[3])
+		if err != nil || size < 1 {
+			return fmt.Errorf("invalid buffer size '%s'", fields[3])
+		}
+		if c.machine(fields[2]).Input != nil {
+			return fmt.Errorf("machine '%s' already has input", fields[2])
+		}
+		c.Links = append(c.Links, NetworkLink{fields[1], fields[2], size})
+		return nil
+	case fields[0] == "input" && len(fields) == 3:
+		m := c.machine(fields[1])
+		if m == nil {
+			return fmt.Errorf("unknown machine '%s'", fields[1])
+		}
+		for _, l := range c.Links {
+			if l.To == m.Name {
+				return fmt.Errorf("machine '%s' already has an input link", m.Name)
+			}
+		}
+		input, err := g.ParseInputs(strings.Split(fields[2], ","))
+		if err != nil {
+			return err
+		}
+		m.Input = input
+		return nil
+	}
+	return fmt.Errorf("invalid line '%s'", strings.Join(fields, " "))
+}
+
+// ParseNetwork reads a network file.
+func ParseNetwork(r io.Reader, g Geometry) (config *NetworkConfig, errors []error) {
+	// Network file format:
+	// # comment allowed
+	// machine NAME PATH
+	// link FROM TO SIZE
+	// input NAME 1,2,3
+	config = &NetworkConfig{}
+	lineNo := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lineNo++
+		fields := strings.Fields(stripComment(scanner.Text()))
+		if len(fields) == 0 {
+			continue
+		}
+		if err := config.parseLine(fields, g.orStandard()); err != nil {
+			errors = append(errors, newError(lineNo, err.Error()))
+		}
+	}
+	return
+}
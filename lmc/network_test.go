@@ -0,0 +1,106 @@
+package lmc
+
+import "context"
+import "errors"
+import "strings"
+import "testing"
+import "github.com/stretchr/testify/assert"
+
+func mustCompile(t *testing.T, code string) *Machine {
+	prog, errs := Compile(strings.NewReader(code))
+	assert.Equal(t, len(errs), 0, "No errors in compilation")
+	return NewMachine(prog)
+}
+
+func TestNetworkPipeline(t *testing.T) {
+	producer := mustCompile(t, `
+loop	IN
+	BRZ	done
+	OUT
+	BR	loop
+done	OUT
+	HLT`)
+	producer.Input = []int{1, 2, 3, 0}
+	doubler := mustCompile(t, `
+loop	IN
+	BRZ	done
+	STO	x
+	ADD	x
+	OUT
+	BR	loop
+done	HLT
+x	DAT`)
+	n := &Network{}
+	assert.Equal(t, n.Add("producer", producer), nil)
+	assert.Equal(t, n.Add("doubler", doubler), nil)
+	// a buffer of 1 makes the producer wait for the doubler
+	assert.Equal(t, n.Connect("producer", "doubler", 1), nil)
+	assert.Equal(t, n.Run(context.Background()), nil)
+	assert.Equal(t, producer.Output, []int{1, 2, 3, 0})
+	assert.Equal(t, doubler.Output, []int{2, 4, 6})
+	assert.Equal(t, producer.Cycles, 16)
+	assert.Equal(t, doubler.Cycles, 21)
+}
+
+func TestNetworkDeadlock(t *testing.T) {
+	code := `
+	IN
+	OUT
+	HLT`
+	n := &Network{}
+	n.Add("a", mustCompile(t, code))
+	n.Add("b", mustCompile(t, code))
+	n.Connect("a", "b", 1)
+	n.Connect("b", "a", 1)
+	err := n.Run(context.Background())
+	assert.Equal(t, errors.Is(err, ErrDeadlock), true)
+	assert.Equal(t, err.Error(), "deadlock after 0 rounds: a on IN, b on IN")
+	assert.Equal(t, n.Nodes[0].VM.Cycles, 0)
+}
+
+func TestNetworkErrors(t *testing.T) {
+	n := &Network{}
+	n.Add("a", mustCompile(t, "\tIN\n\tOUT"))
+	n.Add("b", mustCompile(t, "\tHLT"))
+	assert.Equal(t, n.Add("a", nil).Error(), "machine 'a' already exists")
+	assert.Equal(t, n.Connect("a", "c", 1).Error(), "unknown machine 'c'")
+	assert.Equal(t, n.Connect("a", "b", 0).Error(), "invalid buffer size 0")
+	assert.Equal(t, n.Connect("a", "b", 1), nil)
+	assert.Equal(t, n.Connect("b", "b", 1).Error(), "machine 'b' already has an input link")
+	n.Add("c", mustCompile(t, "\tIN\n\tHLT"))
+	n.Nodes[2].VM.Input = []int{1}
+	assert.Equal(t, n.Connect("a", "c", 1).Error(), "machine 'c' already has input")
+	n.Nodes[2].VM.Input = nil
+	// a has no input, so it stops with an error
+	assert.Equal(t, n.Run(context.Background()), nil)
+	assert.Equal(t, errors.Is(n.Nodes[0].Err, ErrNoMoreInput), true)
+}
+
+func TestParseNetwork(t *testing.T) {
+	config, errs := ParseNetwork(strings.NewReader(`
+# a pipeline
+machine a a.lmc
+machine b b.lmc # doubler
+link a b 4
+input a 1,2
+link a c 1
+link b a x
+input a x
+machine a c.lmc
+route a b
+input b 3
+link b a 1`), Standard)
+	assert.Equal(t, config.Machines, []NetworkMachine{
+		{"a", "a.lmc", []int{1, 2}},
+		{"b", "b.lmc", nil},
+	})
+	assert.Equal(t, config.Links, []NetworkLink{{"a", "b", 4}})
+	assert.Equal(t, len(errs), 7)
+	assert.Equal(t, errs[0], newError(7, "unknown machine 'c'"))
+	assert.Equal(t, errs[1], newError(8, "invalid buffer size 'x'"))
+	assert.Equal(t, errs[3], newError(10, "machine 'a' already exists"))
+	assert.Equal(t, errs[4], newError(11, "invalid line 'route a b'"))
+	// configured input would never be read past the link
+	assert.Equal(t, errs[5], newError(12, "machine 'b' already has an input link"))
+	assert.Equal(t, errs[6], newError(13, "machine 'a' already has input"))
+}
@@ -0,0 +1,129 @@
+package lmc
+
+// Observer is notified before and after each step that the
+// machine executes. Returning an error from either method
+// halts the machine, and the error is returned from Step.
+type Observer interface {
+	BeforeStep(m *Machine, pc int, instr Instruction) error
+	AfterStep(m *Machine, e Effect) error
+}
+
+// Cloner is implemented by observers which keep per-machine
+// state, so that each clone of a machine gets its own copy.
+type Cloner interface {
+	Clone() Observer
+}
+
+// Rewinder is implemented by observers which keep state about
+// the run so far. Restore resets them, and StepBack rewinds
+// them so that they forget about the steps which were undone,
+// leaving only those up to the given no of cycles.
+type Rewinder interface {
+	Reset()
+	Rewind(cycles int)
+}
+
+// WriteObserver is implemented by observers which keep track
+// of writes, so that they see mailboxes set by Machine.Set as
+// well as those written by the program.
+type WriteObserver interface {
+	Written(m *Machine, mailbox int)
+}
+
+// marks remembers the step in which each key was first marked,
+// i.e. the no of cycles once the step has run, so that marks
+// can be rewound along with the machine.
+type marks map[[3]int]int
+
+func (s marks) has(key [3]int) bool {
+	_, ok := s[key]
+	return ok
+}
+
+// mark marks the key, and reports whether it was new.
+func (s marks) mark(key [3]int, step int) bool {
+	if s.has(key) {
+		return false
+	}
+	s[key] = step
+	return true
+}
+
+func (s marks) rewind(cycles int) {
+	for key, step := range s {
+		if step > cycles {
+			delete(s, key)
+		}
+	}
+}
+
+// ObserverFuncs adapts a pair of functions to an Observer.
+// Either of them can be nil.
+type ObserverFuncs struct {
+	Before func(m *Machine, pc int, instr Instruction) error
+	After  func(m *Machine, e Effect) error
+}
+
+func (o ObserverFuncs) BeforeStep(m *Machine, pc int, instr Instruction) error {
+	if o.Before == nil {
+		return nil
+	}
+	return o.Before(m, pc, instr)
+}
+
+func (o ObserverFuncs) AfterStep(m *Machine, e Effect) error {
+	if o.After == nil {
+		return nil
+	}
+	return o.After(m, e)
+}
+
+// CycleLimit stops the machine once it has executed Limit
+// cycles, with a CycleLimitError.
+type CycleLimit struct {
+	Limit int
+}
+
+func (l CycleLimit) BeforeStep(m *Machine, pc int, instr Instruction) error {
+	if m.Cycles >= l.Limit {
+		return CycleLimitError{m.Locate(pc), l.Limit}
+	}
+	return nil
+}
+
+func (l CycleLimit) AfterStep(m *Machine, e Effect) error {
+	return nil
+}
+
+// Heatmap counts the number of times each mailbox is executed.
+type Heatmap struct {
+	Counts map[int]int
+}
+
+func NewHeatmap() *Heatmap {
+	return &Heatmap{map[int]int{}}
+}
+
+func (h *Heatmap) BeforeStep(m *Machine, pc int, instr Instruction) error {
+	h.Counts[pc]++
+	return nil
+}
+
+func (h *Heatmap) AfterStep(m *Machine, e Effect) error {
+	return nil
+}
+
+// Tracer writes a TraceStep for each step to W.
+type Tracer struct {
+	W   TraceWriter
+	acc int
+}
+
+func (t *Tracer) BeforeStep(m *Machine, pc int, instr Instruction) error {
+	t.acc = m.Acc
+	return nil
+}
+
+func (t *Tracer) AfterStep(m *Machine, e Effect) error {
+	return t.W.Write(m.traceStep(t.acc, e))
+}
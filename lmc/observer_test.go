@@ -0,0 +1,56 @@
+package lmc
+
+import "errors"
+import "strings"
+import "testing"
+import "github.com/stretchr/testify/assert"
+
+func TestObservers(t *testing.T) {
+	r := strings.NewReader(`
+loop	SUB	one
+	BRP	loop
+	HLT
+one	DAT	1`)
+	prog, errs := Compile(r)
+	assert.Equal(t, len(errs), 0, "No errors in compilation")
+	vm := NewMachine(prog)
+	heatmap := NewHeatmap()
+	writes := 0
+	vm.Observers = []Observer{
+		heatmap,
+		ObserverFuncs{After: func(m *Machine, e Effect) error {
+			if e.Write >= 0 {
+				writes++
+			}
+			return nil
+		}},
+	}
+	vm.Acc = 2
+	_, err := vm.Run()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, heatmap.Counts, map[int]int{0: 3, 1: 3, 2: 1})
+	assert.Equal(t, writes, 0)
+}
+
+func TestObserverStops(t *testing.T) {
+	r := strings.NewReader(`
+loop	BR	loop`)
+	prog, errs := Compile(r)
+	assert.Equal(t, len(errs), 0, "No errors in compilation")
+	vm := NewMachine(prog)
+	vm.Observers = []Observer{CycleLimit{5}}
+	_, err := vm.Run()
+	assert.Equal(t, errors.Is(err, ErrOutOfCycles), true)
+	assert.Equal(t, vm.Cycles, 5)
+	// errors from AfterStep are returned after the step has
+	// been executed
+	stop := errors.New("stop")
+	vm.Restore()
+	vm.Observers = []Observer{ObserverFuncs{After: func(m *Machine, e Effect) error {
+		return stop
+	}}}
+	_, err = vm.Run()
+	assert.Equal(t, err, stop)
+	assert.Equal(t, vm.Cycles, 1)
+	assert.Equal(t, vm.Halted, true)
+}
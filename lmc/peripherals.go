@@ -0,0 +1,190 @@
+package lmc
+
+import "fmt"
+import "math/rand"
+import "strconv"
+import "strings"
+
+// The built-in devices are:
+//
+//	RND      931  rng       load a random number
+//	CLK      932  clock     load the no of cycles executed
+//	KEY      933  keyboard  load the next key, or 0 if none
+//	                        has been pressed
+//	display  mailboxes      a buffer of 7-segment digits
+//
+// Each of the ports loads into the accumulator and clears the
+// negative flag, like LDA.
+
+// RNG is a random number source. The numbers only depend on the
+// seed, so runs can be repeated.
+type RNG struct {
+	Seed int64
+	rand *rand.Rand
+}
+
+func NewRNG(seed int64) *RNG {
+	return &RNG{Seed: seed, rand: rand.New(rand.NewSource(seed))}
+}
+
+func (r *RNG) Name() string          { return "rng" }
+func (r *RNG) Clone() Device         { return NewRNG(r.Seed) }
+func (r *RNG) Reset()                { r.rand.Seed(r.Seed) }
+func (r *RNG) Ports() map[string]int { return map[string]int{"RND": 931} }
+
+func (r *RNG) Execute(m *Machine, code int) (int, error) {
+	m.Acc = r.rand.Intn(m.geometry().Max() + 1)
+	m.Neg = false
+	return m.Acc, nil
+}
+
+// Clock tells the time in cycles, wrapping around once the
+// count no longer fits in a mailbox.
+type Clock struct{}
+
+func (c Clock) Name() string          { return "clock" }
+func (c Clock) Clone() Device         { return Clock{} }
+func (c Clock) Reset()                {}
+func (c Clock) Ports() map[string]int { return map[string]int{"CLK": 932} }
+
+func (c Clock) Execute(m *Machine, code int) (int, error) {
+	m.Acc = m.Cycles % (m.geometry().Max() + 1)
+	m.Neg = false
+	return m.Acc, nil
+}
+
+// Keyboard is a queue of key presses, which starts off with
+// Keys.
+type Keyboard struct {
+	Keys  []int
+	queue []int
+}
+
+func NewKeyboard(keys ...int) *Keyboard {
+	k := &Keyboard{Keys: keys}
+	k.Reset()
+	return k
+}
+
+func (k *Keyboard) Name() string          { return "keyboard" }
+func (k *Keyboard) Clone() Device         { return NewKeyboard(k.Keys...) }
+func (k *Keyboard) Reset()                { k.queue = append([]int{}, k.Keys...) }
+func (k *Keyboard) Ports() map[string]int { return map[string]int{"KEY": 933} }
+
+// Press adds keys to the end of the queue.
+func (k *Keyboard) Press(keys ...int) {
+	k.queue = append(k.queue, keys...)
+}
+
+func (k *Keyboard) Execute(m *Machine, code int) (int, error) {
+	m.Acc = 0
+	if len(k.queue) > 0 {
+		m.Acc = k.queue[0]
+		k.queue = k.queue[1:]
+	}
+	m.Neg = false
+	return m.Acc, nil
+}
+
+// Display is a 7-segment display with one digit per mailbox,
+// starting from First. Each digit shows the last decimal digit
+// of the value stored in its mailbox.
+type Display struct {
+	First  int
+	Digits []int
+}
+
+func NewDisplay(first int, n int) *Display {
+	return &Display{First: first, Digits: make([]int, n)}
+}
+
+func (d *Display) Name() string                  { return "display" }
+func (d *Display) Clone() Device                 { return NewDisplay(d.First, len(d.Digits)) }
+func (d *Display) Mailboxes() (first int, n int) { return d.First, len(d.Digits) }
+func (d *Display) Load(offset int) int           { return d.Digits[offset] }
+func (d *Display) Store(offset int, value int)   { d.Digits[offset] = value }
+
+func (d *Display) Reset() {
+	for i := range d.Digits {
+		d.Digits[i] = 0
+	}
+}
+
+// String returns the digits shown on the display.
+func (d *Display) String() string {
+	b := strings.Builder{}
+	for _, n := range d.Digits {
+		b.WriteByte(byte('0' + n%10))
+	}
+	return b.String()
+}
+
+// DeviceNames are the names understood by ParseDevice.
+var DeviceNames = []string{"rng", "clock", "keyboard", "display"}
+
+// ParseDevice returns a built-in device from a spec of the form
+// name or name=arg:
+//
+//	rng=SEED           seed defaults to 0
+//	clock
+//	keyboard=KEYS      the keys are the characters of KEYS,
+//	                   which have to fit in the geometry
+//	display=FIRST:N    N defaults to 4
+func ParseDevice(spec string, g Geometry) (Device, error) {
+	name, arg := spec, ""
+	if i := strings.Index(spec, "="); i >= 0 {
+		name, arg = spec[:i], spec[i+1:]
+	}
+	switch name {
+	case "rng":
+		seed := int64(0)
+		if arg != "" {
+			n, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid seed '%s'", arg)
+			}
+			seed = n
+		}
+		return NewRNG(seed), nil
+	case "clock":
+		return Clock{}, nil
+	case "keyboard":
+		keys := []int{}
+		g = g.orStandard()
+		for _, r := range arg {
+			if int(r) > g.Max() {
+				return nil, fmt.Errorf("key '%c' does not fit in %d digits", r, g.Digits)
+			}
+			keys = append(keys, int(r))
+		}
+		return NewKeyboard(keys...), nil
+	case "display":
+		parts := strings.SplitN(arg, ":", 2)
+		first, err := strconv.Atoi(parts[0])
+		n := 4
+		if err == nil && len(parts) == 2 {
+			n, err = strconv.Atoi(parts[1])
+		}
+		if err != nil || first < 0 || n <= 0 {
+			return nil, fmt.Errorf("invalid display '%s', expected FIRST:N", arg)
+		}
+		return NewDisplay(first, n), nil
+	}
+	return nil, fmt.Errorf("unknown device '%s'", name)
+}
+
+// ParseDevices parses a comma separated list of device specs.
+func ParseDevices(specs string, g Geometry) ([]Device, error) {
+	devices := []Device{}
+	for _, spec := range strings.Split(specs, ",") {
+		if spec = strings.TrimSpace(spec); spec == "" {
+			continue
+		}
+		d, err := ParseDevice(spec, g)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, d)
+	}
+	return devices, nil
+}
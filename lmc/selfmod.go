@@ -0,0 +1,130 @@
+package lmc
+
+import "errors"
+import "fmt"
+
+// ErrSelfModifying is wrapped by SelfModifyingError.
+var ErrSelfModifying = errors.New("self-modifying code")
+
+// SelfModKind is the kind of a SelfModEvent.
+type SelfModKind int
+
+const (
+	// WroteCode is a write to a mailbox which holds an
+	// instruction or has already been executed.
+	WroteCode SelfModKind = iota
+	// RanWritten is the execution of a mailbox which was
+	// written at runtime.
+	RanWritten
+)
+
+// SelfModEvent is an instance of self-modifying code.
+type SelfModEvent struct {
+	Kind SelfModKind
+	// Location of the instruction which did the write, or
+	// which was executed after being written.
+	Location
+	Mailbox int // mailbox written or executed
+}
+
+func (e SelfModEvent) String() string {
+	if e.Kind == RanWritten {
+		return fmt.Sprintf("%s: executed %s, which was written at runtime", e.Location, e.mailbox(e.Mailbox))
+	}
+	return fmt.Sprintf("%s: wrote to %s, which holds code", e.Location, e.mailbox(e.Mailbox))
+}
+
+// SelfModifyingError is returned by a SelfModDetector which
+// forbids self-modifying code.
+type SelfModifyingError struct {
+	SelfModEvent
+}
+
+func (e SelfModifyingError) Error() string {
+	return e.SelfModEvent.String()
+}
+
+func (e SelfModifyingError) Unwrap() error { return ErrSelfModifying }
+
+// SelfModDetector records self-modifying code in Events. A
+// mailbox holds code if it was compiled from an instruction
+// other than DAT, or if it has been executed. Each kind of
+// event is only recorded once per instruction and mailbox.
+type SelfModDetector struct {
+	Events []SelfModEvent
+	// Forbid stops the machine with a SelfModifyingError on
+	// the first event.
+	Forbid   bool
+	executed marks // by mailbox
+	written  marks // by mailbox
+	seen     marks // by kind, pc and mailbox
+}
+
+func NewSelfModDetector(forbid bool) *SelfModDetector {
+	d := &SelfModDetector{Forbid: forbid}
+	d.Reset()
+	return d
+}
+
+func (d *SelfModDetector) Reset() {
+	d.Events = nil
+	d.executed = marks{}
+	d.written = marks{}
+	d.seen = marks{}
+}
+
+func (d *SelfModDetector) Rewind(cycles int) {
+	d.executed.rewind(cycles)
+	d.written.rewind(cycles)
+	d.seen.rewind(cycles)
+	var events []SelfModEvent
+	for _, e := range d.Events {
+		if d.seen.has([3]int{int(e.Kind), e.PC, e.Mailbox}) {
+			events = append(events, e)
+		}
+	}
+	d.Events = events
+}
+
+func (d *SelfModDetector) Clone() Observer {
+	return NewSelfModDetector(d.Forbid)
+}
+
+func (d *SelfModDetector) record(m *Machine, step int, kind SelfModKind, pc int, mailbox int) error {
+	if !d.seen.mark([3]int{int(kind), pc, mailbox}, step) {
+		return nil
+	}
+	e := SelfModEvent{kind, m.Locate(pc), mailbox}
+	d.Events = append(d.Events, e)
+	if d.Forbid {
+		return SelfModifyingError{e}
+	}
+	return nil
+}
+
+func (d *SelfModDetector) BeforeStep(m *Machine, pc int, instr Instruction) error {
+	if d.written.has([3]int{pc}) {
+		return d.record(m, m.Cycles+1, RanWritten, pc, pc)
+	}
+	return nil
+}
+
+func (d *SelfModDetector) AfterStep(m *Machine, e Effect) error {
+	d.executed.mark([3]int{e.PC}, m.Cycles)
+	if e.Write < 0 {
+		return nil
+	}
+	d.written.mark([3]int{e.Write}, m.Cycles)
+	code := d.executed.has([3]int{e.Write})
+	// without a program, only executed mailboxes are known
+	// to hold code
+	if prog := m.Program(); prog != nil {
+		if line := prog.LineAt(e.Write); line != nil && line.Instr != "DAT" {
+			code = true
+		}
+	}
+	if code {
+		return d.record(m, m.Cycles, WroteCode, e.PC, e.Write)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package lmc
+
+import "errors"
+import "strings"
+import "testing"
+import "github.com/stretchr/testify/assert"
+
+func TestSelfModDetector(t *testing.T) {
+	r := strings.NewReader(`
+	LDA	hlt
+	STO	patch
+	STO	x
+patch	OUT
+	HLT
+hlt	DAT	0
+x	DAT`)
+	prog, errs := Compile(r)
+	assert.Equal(t, len(errs), 0, "No errors in compilation")
+	vm := NewMachine(prog)
+	d := NewSelfModDetector(false)
+	vm.Observers = []Observer{d}
+	_, err := vm.Run()
+	assert.Equal(t, err, nil)
+	// writing to x is fine since it only holds data
+	assert.Equal(t, len(d.Events), 2)
+	assert.Equal(t, d.Events[0].Kind, WroteCode)
+	assert.Equal(t, d.Events[0].Mailbox, 3)
+	assert.Equal(t, d.Events[0].String(), "line 3 (mailbox 01, STO): wrote to mailbox 03, which holds code")
+	assert.Equal(t, d.Events[1].Kind, RanWritten)
+	assert.Equal(t, d.Events[1].String(), "line 5 (mailbox 03, OUT): executed mailbox 03, which was written at runtime")
+	// restoring the machine forgets what has been seen
+	vm.Restore()
+	_, err = vm.Run()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(d.Events), 2)
+}
+
+func TestSelfModDetectorExecuted(t *testing.T) {
+	// x is executed as a no-op before it is written to
+	r := strings.NewReader(`
+	BR	x
+back	STO	x
+	HLT
+x	DAT	400
+	BR	back`)
+	prog, errs := Compile(r)
+	assert.Equal(t, len(errs), 0, "No errors in compilation")
+	vm := NewMachine(prog)
+	d := NewSelfModDetector(true)
+	vm.Observers = []Observer{d}
+	_, err := vm.Run()
+	assert.Equal(t, errors.Is(err, ErrSelfModifying), true)
+	assert.Equal(t, err.Error(), "line 3 (mailbox 01, STO): wrote to mailbox 03, which holds code")
+	assert.Equal(t, len(d.Events), 1)
+}
+
+func TestSelfModBatch(t *testing.T) {
+	r := strings.NewReader(`
+	IN
+	STO	patch
+patch	DAT	0
+	HLT`)
+	prog, errs := Compile(r)
+	assert.Equal(t, len(errs), 0, "No errors in compilation")
+	b, errs := ParseBatch(strings.NewReader(`
+!self-modifying forbid
+out;902;902;10
+halt;0;;10
+!self-modifying maybe`))
+	assert.Equal(t, b.SelfModifying, "forbid")
+	assert.Equal(t, errs, []error{
+		newError(5, "invalid self-modifying rule 'maybe', expected report or forbid"),
+	})
+	vm := NewMachine(prog)
+	vm.Observers = []Observer{NewSelfModDetector(true)}
+	res := RunTestCases(2, vm, b.Cases)
+	assert.Equal(t, res[0].Status(), StatusSelfModifying)
+	assert.Equal(t, len(res[0].SelfModifying), 1)
+	assert.Equal(t, res[1].Status(), StatusSelfModifying)
+	vm.Observers = []Observer{NewSelfModDetector(false)}
+	res = RunTestCases(2, vm, b.Cases)
+	assert.Equal(t, res[0].Status(), StatusPassed)
+	assert.Equal(t, res[0].Output, []int{902})
+	assert.Equal(t, len(res[0].SelfModifying), 1)
+	assert.Equal(t, res[0].SelfModifying[0].Kind, RanWritten)
+	assert.Equal(t, res[1].Status(), StatusPassed)
+}
+
+func TestSelfModDetectorNoProgram(t *testing.T) {
+	prog, errs := Compile(strings.NewReader(`
+loop	STO	x
+	BR	loop
+x	DAT`))
+	assert.Equal(t, len(errs), 0, "No errors in compilation")
+	// a snapshot resumed without the code has no program
+	vm, err := NewMachine(prog).Snapshot().Machine(nil)
+	assert.Equal(t, err, nil)
+	d := NewSelfModDetector(false)
+	vm.Observers = []Observer{d, CycleLimit{4}}
+	_, err = vm.Run()
+	assert.Equal(t, errors.Is(err, ErrOutOfCycles), true)
+	assert.Equal(t, len(d.Events), 0)
+}
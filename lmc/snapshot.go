@@ -0,0 +1,175 @@
+package lmc
+
+import "io"
+import "fmt"
+import "encoding/json"
+
+// SnapshotVersion is the version of the snapshot format
+// written by this package.
+const SnapshotVersion = 1
+
+// Snapshot is the serializable state of a machine. Input is
+// the remaining input; it only includes values that are known
+// to the machine, i.e. those in Input or in a SliceInput.
+type Snapshot struct {
+	Version int    `json:"version"`
+	Dialect string `json:"dialect,omitempty"`
+	// Geometry is omitted for the Standard geometry.
+	Geometry *Geometry `json:"geometry,omitempty"`
+	Mem      []int     `json:"mem"`
+	Image    []int     `json:"image"`
+	Acc      int       `json:"acc"`
+	PC       int       `json:"pc"`
+	Neg      bool      `json:"neg"`
+	// SP and StackSize are omitted without the stack extension.
+	SP        int   `json:"sp,omitempty"`
+	StackSize int   `json:"stack_size,omitempty"`
+	Halted    bool  `json:"halted"`
+	Input     []int `json:"input"`
+	Output    []int `json:"output"`
+	// Channels is omitted if every output is a number.
+	Channels []Channel `json:"channels,omitempty"`
+	Cycles   int       `json:"cycles"`
+	Read     int       `json:"read"` // no of inputs consumed
+}
+
+// Snapshot captures the state of the machine.
+func (c *Machine) Snapshot() Snapshot {
+	input := append([]int{}, c.pending...)
+	if s, ok := c.In.(*SliceInput); ok {
+		input = append(input, s.values...)
+	} else if c.In == nil {
+		input = append(input, c.Input...)
+	}
+	var channels []Channel
+	for _, ch := range c.Channels {
+		if ch != Numeric {
+			channels = append([]Channel{}, c.Channels...)
+			break
+		}
+	}
+	sp := 0
+	if c.StackSize > 0 {
+		sp = c.SP
+	}
+	var geometry *Geometry
+	if g := c.geometry(); g != Standard {
+		geometry = &g
+	}
+	return Snapshot{
+		Version:   SnapshotVersion,
+		Geometry:  geometry,
+		Dialect:   c.dialect().Name,
+		Mem:       append([]int{}, c.Mem...),
+		Image:     append([]int{}, c.image...),
+		Acc:       c.Acc,
+		PC:        c.PC,
+		Neg:       c.Neg,
+		SP:        sp,
+		StackSize: c.StackSize,
+		Halted:    c.Halted,
+		Input:     input,
+		Output:    append([]int{}, c.Output...),
+		Channels:  channels,
+		Cycles:    c.Cycles,
+		Read:      c.read,
+	}
+}
+
+// Machine returns a machine in the state captured by the
+// snapshot. The program is optional, and is only used to
+// point back at the source. The remaining input is read
+// before anything in In or Input.
+func (s Snapshot) Machine(prog *Program) (*Machine, error) {
+	if s.Version != SnapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", s.Version)
+	}
+	g := Standard
+	if s.Geometry != nil {
+		g = *s.Geometry
+	}
+	if err := g.Validate(); err != nil {
+		return nil, err
+	}
+	if prog != nil && prog.Geometry.orStandard() != g {
+		return nil, fmt.Errorf("snapshot is for a %s machine, but the program is for %s", g, prog.Geometry.orStandard())
+	}
+	if len(s.Mem) != g.Mailboxes {
+		return nil, fmt.Errorf("snapshot has %d mailboxes, expected %d", len(s.Mem), g.Mailboxes)
+	}
+	if len(s.Image) != 0 && len(s.Image) != g.Mailboxes {
+		return nil, fmt.Errorf("snapshot image has %d mailboxes, expected %d", len(s.Image), g.Mailboxes)
+	}
+	// the pc can be one past the last mailbox once it has run
+	// off the end
+	if s.PC < 0 || s.PC > g.Mailboxes {
+		return nil, fmt.Errorf("invalid program counter %d", s.PC)
+	}
+	if s.Read < 0 || s.Cycles < 0 {
+		return nil, fmt.Errorf("invalid counts in snapshot")
+	}
+	if s.Acc < 0 || s.Acc > g.Max() {
+		return nil, fmt.Errorf("accumulator %d does not fit in %d digits", s.Acc, g.Digits)
+	}
+	for name, values := range map[string][]int{"mem": s.Mem, "image": s.Image, "input": s.Input} {
+		for i, n := range values {
+			if n < 0 || n > g.Max() {
+				return nil, fmt.Errorf("snapshot %s[%d] = %d does not fit in %d digits", name, i, n, g.Digits)
+			}
+		}
+	}
+	vm := newMachineFromSlice(g, s.Mem)
+	if s.Dialect != "" {
+		d, err := LookupDialect(s.Dialect)
+		if err != nil {
+			return nil, err
+		}
+		vm.Dialect = d
+	} else if prog != nil {
+		vm.Dialect = prog.Dialect
+	}
+	if len(s.Image) != 0 {
+		copy(vm.image, s.Image)
+	}
+	vm.prog = prog
+	vm.Acc = s.Acc
+	vm.PC = s.PC
+	vm.Neg = s.Neg
+	if s.StackSize > 0 {
+		if s.StackSize >= g.Mailboxes || s.SP < g.Mailboxes-s.StackSize || s.SP > g.Mailboxes {
+			return nil, fmt.Errorf("invalid stack pointer %d for a stack of %d values", s.SP, s.StackSize)
+		}
+		vm.StackSize = s.StackSize
+		vm.SP = s.SP
+	}
+	vm.Halted = s.Halted
+	vm.pending = append([]int{}, s.Input...)
+	vm.Output = append([]int{}, s.Output...)
+	vm.Channels = append([]Channel{}, s.Channels...)
+	for len(vm.Channels) < len(vm.Output) {
+		vm.Channels = append(vm.Channels, Numeric)
+	}
+	vm.Cycles = s.Cycles
+	vm.read = s.Read
+	return vm, nil
+}
+
+// WriteSnapshot writes the snapshot as JSON.
+func WriteSnapshot(w io.Writer, s Snapshot) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+// ReadSnapshot reads a snapshot written by WriteSnapshot.
+func ReadSnapshot(r io.Reader) (Snapshot, error) {
+	s := Snapshot{}
+	err := json.NewDecoder(r).Decode(&s)
+	if err != nil {
+		return s, err
+	}
+	if s.Version != SnapshotVersion {
+		return s, fmt.Errorf("unsupported snapshot version %d", s.Version)
+	}
+	return s, nil
+}
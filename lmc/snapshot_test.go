@@ -0,0 +1,88 @@
+package lmc
+
+import "bytes"
+import "fmt"
+import "strings"
+import "testing"
+import "github.com/stretchr/testify/assert"
+
+func TestSnapshot(t *testing.T) {
+	prog, errs := Compile(strings.NewReader(`
+	IN
+	STO	x
+	IN
+	ADD	x
+	OUT
+	HLT
+x	DAT`))
+	assert.Equal(t, len(errs), 0, "No errors in compilation")
+	vm := NewMachine(prog)
+	vm.In = NewSliceInput([]int{3, 4})
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, vm.Step(), nil)
+	}
+	buf := &bytes.Buffer{}
+	assert.Equal(t, WriteSnapshot(buf, vm.Snapshot()), nil)
+	s, err := ReadSnapshot(buf)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, s.Input, []int{4})
+	assert.Equal(t, s.Cycles, 2)
+
+	resumed, err := s.Machine(prog)
+	assert.Equal(t, err, nil)
+	output, err := resumed.Run()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, output, []int{7})
+	assert.Equal(t, resumed.Cycles, 6)
+	assert.Equal(t, resumed.Locate(1).Line.LineNo, 3)
+	// the image is kept, so the machine can still be restored
+	resumed.Restore()
+	assert.Equal(t, resumed.Mem[6], 0)
+	assert.Equal(t, resumed.Acc, 0)
+}
+
+func TestReadSnapshotErrors(t *testing.T) {
+	_, err := ReadSnapshot(strings.NewReader(`{"version": 2}`))
+	assert.Equal(t, err.Error(), "unsupported snapshot version 2")
+	s, err := ReadSnapshot(strings.NewReader(`{"version": 1, "mem": [1, 2]}`))
+	assert.Equal(t, err, nil)
+	_, err = s.Machine(nil)
+	assert.Equal(t, err.Error(), "snapshot has 2 mailboxes, expected 100")
+	mem := `"mem": [` + strings.Repeat("0, ", 99) + `%s]`
+	for _, c := range []struct {
+		json string
+		err  string
+	}{
+		{`{"version": 1, "pc": -1, ` + fmt.Sprintf(mem, "0") + `}`, "invalid program counter -1"},
+		{`{"version": 1, "pc": 101, ` + fmt.Sprintf(mem, "0") + `}`, "invalid program counter 101"},
+		{`{"version": 1, "read": -1, ` + fmt.Sprintf(mem, "0") + `}`, "invalid counts in snapshot"},
+		{`{"version": 1, "acc": 1000, ` + fmt.Sprintf(mem, "0") + `}`, "accumulator 1000 does not fit in 3 digits"},
+		{`{"version": 1, ` + fmt.Sprintf(mem, "1000") + `}`, "snapshot mem[99] = 1000 does not fit in 3 digits"},
+		{`{"version": 1, "pc": 100, ` + fmt.Sprintf(mem, "0") + `}`, ""},
+	} {
+		s, err := ReadSnapshot(strings.NewReader(c.json))
+		assert.Equal(t, err, nil)
+		_, err = s.Machine(nil)
+		if c.err == "" {
+			assert.Equal(t, err, nil)
+		} else {
+			assert.Equal(t, err.Error(), c.err)
+		}
+	}
+}
+
+func TestSnapshotGeometry(t *testing.T) {
+	prog, errs := Assembler{Geometry: Geometry{1000, 4}}.Compile(strings.NewReader("\tIN\n\tOUT\n\tHLT"))
+	assert.Equal(t, len(errs), 0, "No errors in compilation")
+	buf := &bytes.Buffer{}
+	assert.Equal(t, WriteSnapshot(buf, NewMachine(prog).Snapshot()), nil)
+	s, err := ReadSnapshot(buf)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, *s.Geometry, Geometry{1000, 4})
+	_, err = s.Machine(&Program{})
+	assert.Equal(t, err.Error(), "snapshot is for a 1000x4 machine, but the program is for 100x3")
+	vm, err := s.Machine(nil)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(vm.Mem), 1000)
+	assert.Equal(t, vm.Mem[:3], []int{9001, 9002, 0})
+}
@@ -0,0 +1,100 @@
+package lmc
+
+import "errors"
+import "fmt"
+
+// ErrStackOverflow and ErrStackUnderflow are wrapped by
+// StackOverflowError and StackUnderflowError respectively.
+var ErrStackOverflow error = errors.New("stack overflow")
+var ErrStackUnderflow error = errors.New("stack underflow")
+
+// The stack extension is enabled by reserving mailboxes for the
+// stack, see Assembler.StackSize and Machine.StackSize. The stack
+// lives at the end of memory and grows downwards:
+//
+//	CALL xx  4xx  push the address of the next instruction and
+//	              branch to xx
+//	RET      913  pop an address and branch to it
+//	PUSH     911  push the accumulator
+//	POP      912  pop into the accumulator
+//
+// SP is the mailbox at the top of the stack, and is equal to the
+// number of mailboxes when the stack is empty.
+var stackLookup = map[string]int{
+	"CALL": 400,
+	"PUSH": 911,
+	"POP":  912,
+	"RET":  913,
+}
+
+var stackNames = map[int]string{
+	400: "CALL",
+	911: "PUSH",
+	912: "POP",
+	913: "RET",
+}
+
+// StackOverflowError is returned when PUSH or CALL is executed
+// with a full stack.
+type StackOverflowError struct {
+	Location
+	Size int
+}
+
+func (e StackOverflowError) Error() string {
+	return fmt.Sprintf("%s: stack overflow, the stack holds %d values", e.Location, e.Size)
+}
+
+func (e StackOverflowError) Unwrap() error { return ErrStackOverflow }
+
+// StackUnderflowError is returned when POP or RET is executed
+// with an empty stack.
+type StackUnderflowError struct {
+	Location
+}
+
+func (e StackUnderflowError) Error() string {
+	return fmt.Sprintf("%s: stack underflow", e.Location)
+}
+
+func (e StackUnderflowError) Unwrap() error { return ErrStackUnderflow }
+
+// Stack returns the values on the stack, from the top down.
+func (c *Machine) Stack() []int {
+	if c.SP >= len(c.Mem) || c.SP < 0 {
+		return []int{}
+	}
+	values := make([]int, 0, len(c.Mem)-c.SP)
+	for i := c.SP; i < len(c.Mem); i++ {
+		values = append(values, c.Mem[i])
+	}
+	return values
+}
+
+// push pushes a value onto the stack.
+func (c *Machine) push(pc int, n int, u *undo) error {
+	if c.SP <= len(c.Mem)-c.StackSize {
+		c.Halted = true
+		return StackOverflowError{c.Locate(pc), c.StackSize}
+	}
+	c.SP--
+	if u != nil {
+		u.addr = c.SP
+		u.old = c.Mem[c.SP]
+	}
+	c.Last.Write = c.SP
+	c.Mem[c.SP] = n
+	return nil
+}
+
+// pop pops a value off the stack.
+func (c *Machine) pop(pc int) (int, error) {
+	if c.SP >= len(c.Mem) {
+		c.Halted = true
+		return 0, StackUnderflowError{c.Locate(pc)}
+	}
+	n := c.Mem[c.SP]
+	c.Last.Read = c.SP
+	c.SP++
+	return n, nil
+}
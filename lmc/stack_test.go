@@ -0,0 +1,80 @@
+package lmc
+
+import "bytes"
+import "errors"
+import "strings"
+import "testing"
+import "github.com/stretchr/testify/assert"
+
+const stackCode = `
+	IN
+	CALL	dbl
+	OUT
+	IN
+	CALL	dbl
+	OUT
+	HLT
+dbl	PUSH
+	POP
+	STO	t
+	ADD	t
+	RET
+t	DAT`
+
+func TestStack(t *testing.T) {
+	_, errs := Compile(strings.NewReader(stackCode))
+	assert.Equal(t, errs, []error{newError(3, "invalid instruction 'CALL'")})
+	prog, errs := Assembler{StackSize: 2}.Compile(strings.NewReader(stackCode))
+	assert.Equal(t, len(errs), 0, "No errors in compilation")
+	assert.Equal(t, prog.Mem[:5], []int{901, 407, 902, 901, 407})
+	assert.Equal(t, prog.Mem[7:12], []int{911, 912, 312, 112, 913})
+	vm := NewMachine(prog)
+	vm.Strict = true
+	vm.HistoryLimit = 100
+	vm.Input = []int{3, 4}
+	output, err := vm.Run()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, output, []int{6, 8})
+	assert.Equal(t, vm.Cycles, 17)
+	assert.Equal(t, vm.SP, 100)
+	assert.Equal(t, vm.Mem[98:], []int{4, 5})
+	// the stack pointer is part of the undo log
+	for vm.PC != 9 {
+		assert.Equal(t, vm.StepBack(), nil)
+	}
+	assert.Equal(t, vm.SP, 99)
+	assert.Equal(t, vm.Stack(), []int{5})
+	assert.Equal(t, vm.Locate(11).Mnemonic, "RET")
+	vm.Restore()
+	assert.Equal(t, vm.SP, 100)
+}
+
+func TestStackErrors(t *testing.T) {
+	prog, _ := Assembler{StackSize: 1}.Compile(strings.NewReader(stackCode))
+	vm := NewMachine(prog)
+	vm.Input = []int{3}
+	_, err := vm.Run()
+	assert.Equal(t, errors.Is(err, ErrStackOverflow), true)
+	assert.Equal(t, err.Error(), "line 9 (mailbox 07, PUSH): stack overflow, the stack holds 1 values")
+
+	prog, _ = Assembler{StackSize: 1}.Compile(strings.NewReader("\tPOP"))
+	_, err = NewMachine(prog).Run()
+	assert.Equal(t, err.Error(), "line 1 (mailbox 00, POP): stack underflow")
+	assert.Equal(t, errors.Is(err, ErrStackUnderflow), true)
+
+	code := strings.Repeat("\tHLT\n", 91)
+	_, errs := Assembler{StackSize: 10}.Compile(strings.NewReader(code))
+	assert.Equal(t, errs, []error{newError(91, "out of mailboxes")})
+	_, errs = Assembler{StackSize: 100}.Compile(strings.NewReader(code))
+	assert.Equal(t, len(errs), 1)
+}
+
+func TestStackTrace(t *testing.T) {
+	prog, _ := Assembler{StackSize: 2}.Compile(strings.NewReader("\tPUSH\n\tHLT"))
+	vm := NewMachine(prog)
+	b := &bytes.Buffer{}
+	vm.Observers = []Observer{&Tracer{W: NewJSONTraceWriter(b)}}
+	_, err := vm.Run()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, strings.Split(b.String(), "\n")[0], `{"cycle":1,"pc":0,"line":1,"instr":911,"mnemonic":"PUSH","operand":null,"acc_before":0,"acc_after":0,"neg":false,"write":{"mailbox":99,"value":0},"input":null,"output":null,"sp":99,"stack":[0]}`)
+}
@@ -0,0 +1,178 @@
+package lmc
+
+import "io"
+import "strconv"
+import "encoding/csv"
+import "encoding/json"
+
+// TraceWrite is a write to memory made by a step.
+type TraceWrite struct {
+	Mailbox int `json:"mailbox"`
+	Value   int `json:"value"`
+}
+
+// TraceStep is a record of a single executed step.
+type TraceStep struct {
+	Cycle     int         `json:"cycle"`
+	PC        int         `json:"pc"`
+	Line      int         `json:"line,omitempty"`
+	Instr     int         `json:"instr"`
+	Mnemonic  string      `json:"mnemonic"`
+	Operand   *int        `json:"operand"`
+	Label     string      `json:"label,omitempty"` // label of the operand
+	AccBefore int         `json:"acc_before"`
+	AccAfter  int         `json:"acc_after"`
+	Neg       bool        `json:"neg"`
+	Write     *TraceWrite `json:"write"`
+	Input     *int        `json:"input"`
+	Output    *int        `json:"output"`
+	// SP and Stack are only set with the stack extension;
+	// Stack is from the top down.
+	SP    *int  `json:"sp,omitempty"`
+	Stack []int `json:"stack,omitempty"`
+	// Device is set if the step interacted with a device.
+	Device *DeviceEvent `json:"device,omitempty"`
+}
+
+// hasOperand reports whether the opcode takes an address.
+func hasOperand(opcode int) bool {
+	switch opcode {
+	case 1, 2, 3, 5, 6, 7, 8:
+		return true
+	}
+	return false
+}
+
+// traceStep builds the record of a step from its effect.
+func (c *Machine) traceStep(acc int, last Effect) TraceStep {
+	t := TraceStep{
+		Cycle:     c.Cycles,
+		PC:        last.PC,
+		Instr:     last.Instr,
+		Mnemonic:  c.Mnemonic(last.Instr),
+		AccBefore: acc,
+		AccAfter:  c.Acc,
+		Neg:       c.Neg,
+	}
+	if c.prog != nil {
+		if line := c.prog.LineAt(last.PC); line != nil {
+			t.Line = line.LineNo
+		}
+	}
+	if instr := c.geometry().Decode(last.Instr); hasOperand(instr.Opcode) || (instr.Opcode == 4 && c.StackSize > 0) {
+		operand := instr.Addr
+		t.Operand = &operand
+		if c.prog != nil {
+			if line := c.prog.LineAt(operand); line != nil {
+				t.Label = line.Label
+			}
+		}
+	}
+	if last.Write >= 0 {
+		t.Write = &TraceWrite{last.Write, c.Mem[last.Write]}
+	}
+	if last.In {
+		t.Input = &last.Value
+	}
+	if last.Out {
+		t.Output = &last.Value
+	}
+	if c.StackSize > 0 {
+		sp := c.SP
+		t.SP = &sp
+		t.Stack = c.Stack()
+	}
+	t.Device = last.Device
+	return t
+}
+
+// TraceWriter writes trace records in some format.
+type TraceWriter interface {
+	Write(t TraceStep) error
+	Flush() error
+}
+
+type jsonTraceWriter struct {
+	enc *json.Encoder
+}
+
+// NewJSONTraceWriter writes each record as a line of JSON.
+func NewJSONTraceWriter(w io.Writer) TraceWriter {
+	return jsonTraceWriter{json.NewEncoder(w)}
+}
+
+func (j jsonTraceWriter) Write(t TraceStep) error {
+	return j.enc.Encode(t)
+}
+
+func (j jsonTraceWriter) Flush() error {
+	return nil
+}
+
+var traceHeader = []string{
+	"cycle", "pc", "line", "instr", "mnemonic", "operand", "label",
+	"acc_before", "acc_after", "neg",
+	"write_mailbox", "write_value", "input", "output", "sp", "device",
+}
+
+type csvTraceWriter struct {
+	w      *csv.Writer
+	header bool
+}
+
+// NewCSVTraceWriter writes records as CSV, with a header row.
+func NewCSVTraceWriter(w io.Writer) TraceWriter {
+	return &csvTraceWriter{w: csv.NewWriter(w)}
+}
+
+func optional(n *int) string {
+	if n == nil {
+		return ""
+	}
+	return strconv.Itoa(*n)
+}
+
+func (c *csvTraceWriter) Write(t TraceStep) error {
+	if !c.header {
+		c.header = true
+		if err := c.w.Write(traceHeader); err != nil {
+			return err
+		}
+	}
+	line := ""
+	if t.Line != 0 {
+		line = strconv.Itoa(t.Line)
+	}
+	writeMailbox, writeValue := "", ""
+	if t.Write != nil {
+		writeMailbox = strconv.Itoa(t.Write.Mailbox)
+		writeValue = strconv.Itoa(t.Write.Value)
+	}
+	device := ""
+	if t.Device != nil {
+		device = t.Device.String()
+	}
+	return c.w.Write([]string{
+		strconv.Itoa(t.Cycle),
+		strconv.Itoa(t.PC),
+		line,
+		strconv.Itoa(t.Instr),
+		t.Mnemonic,
+		optional(t.Operand),
+		t.Label,
+		strconv.Itoa(t.AccBefore),
+		strconv.Itoa(t.AccAfter),
+		strconv.FormatBool(t.Neg),
+		writeMailbox,
+		writeValue,
+		optional(t.Input),
+		optional(t.Output),
+		optional(t.SP),
+		device,
+	})
+}
+
+func (c *csvTraceWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
@@ -0,0 +1,48 @@
+package lmc
+
+import "bytes"
+import "strings"
+import "testing"
+import "github.com/stretchr/testify/assert"
+
+func traceProgram(t *testing.T, w TraceWriter) {
+	r := strings.NewReader(`
+	IN
+	STO	x
+	OUT
+	HLT
+x	DAT`)
+	prog, errs := Compile(r)
+	assert.Equal(t, len(errs), 0, "No errors in compilation")
+	vm := NewMachine(prog)
+	vm.Input = []int{9}
+	vm.Observers = []Observer{&Tracer{W: w}}
+	_, err := vm.Run()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, w.Flush(), nil)
+}
+
+func TestJSONTrace(t *testing.T) {
+	b := &bytes.Buffer{}
+	traceProgram(t, NewJSONTraceWriter(b))
+	assert.Equal(t, b.String(), strings.Join([]string{
+		`{"cycle":1,"pc":0,"line":2,"instr":901,"mnemonic":"IN","operand":null,"acc_before":0,"acc_after":9,"neg":false,"write":null,"input":9,"output":null}`,
+		`{"cycle":2,"pc":1,"line":3,"instr":304,"mnemonic":"STO","operand":4,"label":"x","acc_before":9,"acc_after":9,"neg":false,"write":{"mailbox":4,"value":9},"input":null,"output":null}`,
+		`{"cycle":3,"pc":2,"line":4,"instr":902,"mnemonic":"OUT","operand":null,"acc_before":9,"acc_after":9,"neg":false,"write":null,"input":null,"output":9}`,
+		`{"cycle":4,"pc":3,"line":5,"instr":0,"mnemonic":"HLT","operand":null,"acc_before":9,"acc_after":9,"neg":false,"write":null,"input":null,"output":null}`,
+		``,
+	}, "\n"))
+}
+
+func TestCSVTrace(t *testing.T) {
+	b := &bytes.Buffer{}
+	traceProgram(t, NewCSVTraceWriter(b))
+	assert.Equal(t, b.String(), strings.Join([]string{
+		"cycle,pc,line,instr,mnemonic,operand,label,acc_before,acc_after,neg,write_mailbox,write_value,input,output,sp,device",
+		"1,0,2,901,IN,,,0,9,false,,,9,,,",
+		"2,1,3,304,STO,4,x,9,9,false,4,9,,,,",
+		"3,2,4,902,OUT,,,9,9,false,,,,9,,",
+		"4,3,5,0,HLT,,,9,9,false,,,,,,",
+		"",
+	}, "\n"))
+}
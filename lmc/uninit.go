@@ -0,0 +1,98 @@
+package lmc
+
+import "errors"
+import "fmt"
+
+// ErrUninitializedRead is wrapped by UninitializedReadError.
+var ErrUninitializedRead = errors.New("uninitialized read")
+
+// UninitRead is a read of a mailbox which was neither given a
+// value by the assembler nor written to at runtime.
+type UninitRead struct {
+	Location // of the instruction which did the read
+	Mailbox  int
+}
+
+func (e UninitRead) String() string {
+	return fmt.Sprintf("%s: read uninitialized %s", e.Location, e.mailbox(e.Mailbox))
+}
+
+// UninitializedReadError is returned by an UninitDetector which
+// forbids uninitialized reads.
+type UninitializedReadError struct {
+	UninitRead
+}
+
+func (e UninitializedReadError) Error() string {
+	return e.UninitRead.String()
+}
+
+func (e UninitializedReadError) Unwrap() error { return ErrUninitializedRead }
+
+// UninitDetector records reads of uninitialized mailboxes in
+// Reads. Each instruction and mailbox pair is only recorded
+// once. Mailboxes claimed by a device are always initialized.
+// A machine without a program, e.g. one resumed from a snapshot
+// without the code, has nothing to report.
+type UninitDetector struct {
+	Reads []UninitRead
+	// Forbid stops the machine with an UninitializedReadError
+	// on the first uninitialized read.
+	Forbid  bool
+	written marks // by mailbox
+	seen    marks // by pc and mailbox
+}
+
+func NewUninitDetector(forbid bool) *UninitDetector {
+	d := &UninitDetector{Forbid: forbid}
+	d.Reset()
+	return d
+}
+
+func (d *UninitDetector) Reset() {
+	d.Reads = nil
+	d.written = marks{}
+	d.seen = marks{}
+}
+
+func (d *UninitDetector) Rewind(cycles int) {
+	d.written.rewind(cycles)
+	d.seen.rewind(cycles)
+	var reads []UninitRead
+	for _, r := range d.Reads {
+		if d.seen.has([3]int{r.PC, r.Mailbox}) {
+			reads = append(reads, r)
+		}
+	}
+	d.Reads = reads
+}
+
+func (d *UninitDetector) Clone() Observer {
+	return NewUninitDetector(d.Forbid)
+}
+
+func (d *UninitDetector) BeforeStep(m *Machine, pc int, instr Instruction) error {
+	return nil
+}
+
+func (d *UninitDetector) AfterStep(m *Machine, e Effect) error {
+	prog := m.Program()
+	_, _, mapped := m.device(e.Read)
+	if e.Read >= 0 && prog != nil && !mapped && !d.written.has([3]int{e.Read}) && !prog.Initialized(e.Read) {
+		if d.seen.mark([3]int{e.PC, e.Read}, m.Cycles) {
+			r := UninitRead{m.Locate(e.PC), e.Read}
+			d.Reads = append(d.Reads, r)
+			if d.Forbid {
+				return UninitializedReadError{r}
+			}
+		}
+	}
+	if e.Write >= 0 {
+		d.written.mark([3]int{e.Write}, m.Cycles)
+	}
+	return nil
+}
+
+func (d *UninitDetector) Written(m *Machine, mailbox int) {
+	d.written.mark([3]int{mailbox}, m.Cycles)
+}
@@ -0,0 +1,113 @@
+package lmc
+
+import "errors"
+import "strings"
+import "testing"
+import "github.com/stretchr/testify/assert"
+
+func TestInitialized(t *testing.T) {
+	prog, errs := Compile(strings.NewReader(`
+	LDA	x
+	HLT
+x	DAT
+y	DAT	0`))
+	assert.Equal(t, len(errs), 0, "No errors in compilation")
+	for mailbox, ok := range []bool{true, true, false, true, false} {
+		assert.Equal(t, prog.Initialized(mailbox), ok, mailbox)
+	}
+}
+
+func TestUninitDetector(t *testing.T) {
+	r := strings.NewReader(`
+	LDA	x
+	ADD	50
+	STO	x
+	LDA	x
+	ADD	y
+	OUT
+	HLT
+x	DAT
+y	DAT	1`)
+	prog, errs := Compile(r)
+	assert.Equal(t, len(errs), 0, "No errors in compilation")
+	vm := NewMachine(prog)
+	d := NewUninitDetector(false)
+	vm.Observers = []Observer{d}
+	output, err := vm.Run()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, output, []int{1})
+	// x is fine to read once it has been written to
+	assert.Equal(t, len(d.Reads), 2)
+	assert.Equal(t, d.Reads[0].String(), "line 2 (mailbox 00, LDA): read uninitialized mailbox 07")
+	assert.Equal(t, d.Reads[1].String(), "line 3 (mailbox 01, ADD): read uninitialized mailbox 50")
+
+	vm.Restore()
+	vm.Observers = []Observer{NewUninitDetector(true)}
+	_, err = vm.Run()
+	assert.Equal(t, errors.Is(err, ErrUninitializedRead), true)
+	assert.Equal(t, err.Error(), "line 2 (mailbox 00, LDA): read uninitialized mailbox 07")
+}
+
+func TestUninitBatch(t *testing.T) {
+	r := strings.NewReader(`
+	IN
+	BRZ	skip
+	STO	x
+skip	LDA	x
+	OUT
+	HLT
+x	DAT`)
+	prog, errs := Compile(r)
+	assert.Equal(t, len(errs), 0, "No errors in compilation")
+	b, errs := ParseBatch(strings.NewReader(`
+!uninitialized forbid
+zero;0;0;10
+one;1;1;10`))
+	assert.Equal(t, len(errs), 0)
+	assert.Equal(t, b.Uninitialized, "forbid")
+	vm := NewMachine(prog)
+	vm.Observers = []Observer{NewUninitDetector(true)}
+	res := RunTestCases(2, vm, b.Cases)
+	assert.Equal(t, res[0].Status(), StatusUninitialized)
+	assert.Equal(t, len(res[0].UninitReads), 1)
+	assert.Equal(t, res[1].Status(), StatusPassed)
+	assert.Equal(t, len(res[1].UninitReads), 0)
+}
+
+func TestUninitDevice(t *testing.T) {
+	vm := compileWithDevices(t, `
+	LDA	90
+	OUT
+	HLT`, NewDisplay(90, 4))
+	d := NewUninitDetector(true)
+	vm.Observers = []Observer{d}
+	_, err := vm.Run()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(d.Reads), 0)
+}
+
+func TestUninitStepBack(t *testing.T) {
+	prog, errs := Compile(strings.NewReader(`
+	STO	x
+	LDA	x
+	LDA	y
+	HLT
+x	DAT
+y	DAT`))
+	assert.Equal(t, len(errs), 0, "No errors in compilation")
+	vm := NewMachine(prog)
+	vm.HistoryLimit = 10
+	d := NewUninitDetector(true)
+	vm.Observers = []Observer{d}
+	// stepping back keeps the write to x
+	assert.Equal(t, vm.Step(), nil)
+	assert.Equal(t, vm.Step(), nil)
+	assert.Equal(t, vm.StepBack(), nil)
+	assert.Equal(t, vm.Step(), nil)
+	// an undone read is reported again
+	assert.Equal(t, errors.Is(vm.Step(), ErrUninitializedRead), true)
+	assert.Equal(t, vm.StepBack(), nil)
+	assert.Equal(t, len(d.Reads), 0)
+	assert.Equal(t, errors.Is(vm.Step(), ErrUninitializedRead), true)
+	assert.Equal(t, len(d.Reads), 1)
+}
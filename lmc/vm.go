@@ -0,0 +1,638 @@
+package lmc
+
+import "context"
+import "errors"
+import "fmt"
+import "io"
+
+// ErrNoMoreInput and ErrOutOfCycles are wrapped by
+// OutOfInputError and CycleLimitError respectively.
+var ErrNoMoreInput error = errors.New("no input given")
+var ErrOutOfCycles error = errors.New("out of cycles")
+
+// Mnemonic returns the name of the instruction stored in a
+// mailbox in the OG dialect, or "???" if it is not a valid
+// instruction.
+func Mnemonic(instr int) string {
+	return OG.Mnemonic(instr)
+}
+
+// Location describes where the machine was when a runtime
+// error occurred.
+type Location struct {
+	PC     int
+	Instr  int
+	Cycles int
+	Acc    int
+	Line   *Line
+	// Mnemonic of Instr, empty if the PC is not a mailbox.
+	Mnemonic string
+	// Digits per word of the machine, 0 for the Standard
+	// geometry.
+	Digits int
+}
+
+// digits is the no of digits in a word, Standard by default.
+func (l Location) digits() int {
+	if l.Digits == 0 {
+		return Standard.Digits
+	}
+	return l.Digits
+}
+
+// mailbox formats a mailbox number as wide as an address.
+func (l Location) mailbox(n int) string {
+	return fmt.Sprintf("mailbox %0*d", l.digits()-1, n)
+}
+
+func (l Location) String() string {
+	if l.Line != nil {
+		return fmt.Sprintf("line %d (%s, %s)", l.Line.LineNo, l.mailbox(l.PC), l.Line.Instr)
+	}
+	if l.Mnemonic == "" {
+		return l.mailbox(l.PC)
+	}
+	return fmt.Sprintf("%s (%0*d, %s)", l.mailbox(l.PC), l.digits(), l.Instr, l.Mnemonic)
+}
+
+// OutOfInputError is returned when the machine executes IN but
+// there are no more inputs.
+type OutOfInputError struct {
+	Location
+	Consumed int
+}
+
+func (e OutOfInputError) Error() string {
+	return fmt.Sprintf("%s: no more input after %d values", e.Location, e.Consumed)
+}
+
+func (e OutOfInputError) Unwrap() error { return ErrNoMoreInput }
+
+// InputRangeError is returned when IN reads a value which does
+// not fit in a mailbox.
+type InputRangeError struct {
+	Location
+	Value int
+}
+
+func (e InputRangeError) Error() string {
+	return fmt.Sprintf("%s: input %d does not fit in %d digits", e.Location, e.Value, e.digits())
+}
+
+// CycleLimitError is returned when the machine has executed the
+// maximum number of cycles allowed without halting.
+type CycleLimitError struct {
+	Location
+	Limit int
+}
+
+func (e CycleLimitError) Error() string {
+	return fmt.Sprintf("%s: cycle limit of %d reached", e.Location, e.Limit)
+}
+
+func (e CycleLimitError) Unwrap() error { return ErrOutOfCycles }
+
+// IllegalInstructionError is returned when the machine runs in strict
+// mode and tries to execute an instruction that is undefined, e.g.
+// 4xx or any 9xx other than 901/902.
+type IllegalInstructionError struct {
+	Location
+}
+
+func (e IllegalInstructionError) Error() string {
+	return fmt.Sprintf("%s: illegal instruction %0*d", e.Location, e.digits(), e.Instr)
+}
+
+// PCOverflowError is returned when the program counter runs past
+// the last mailbox.
+type PCOverflowError struct {
+	Location
+}
+
+func (e PCOverflowError) Error() string {
+	return fmt.Sprintf("%s: program counter ran past the last mailbox after %d cycles", e.Location, e.Cycles)
+}
+
+// AddressError is returned when an instruction refers to a
+// mailbox past the last one, which a geometry with fewer
+// mailboxes than its words can address allows.
+type AddressError struct {
+	Location
+	Addr int
+}
+
+func (e AddressError) Error() string {
+	return fmt.Sprintf("%s: %s is out of range", e.Location, e.mailbox(e.Addr))
+}
+
+// CancelledError is returned by RunContext when the context
+// is cancelled or its deadline is exceeded.
+type CancelledError struct {
+	Location
+	Err error
+}
+
+func (e CancelledError) Error() string {
+	return fmt.Sprintf("%s: stopped after %d cycles: %s", e.Location, e.Cycles, e.Err)
+}
+
+func (e CancelledError) Unwrap() error { return e.Err }
+
+// Instruction is a decoded mailbox.
+type Instruction struct {
+	Word   int
+	Opcode int
+	Addr   int
+}
+
+// Decode splits a mailbox of the Standard geometry into its
+// opcode and address.
+func Decode(word int) Instruction {
+	return Standard.Decode(word)
+}
+
+// Mnemonic returns the name of the instruction.
+func (i Instruction) Mnemonic() string {
+	return Mnemonic(i.Word)
+}
+
+// Effect describes what a single step did.
+type Effect struct {
+	PC      int // mailbox the instruction was fetched from
+	Instr   int
+	Read    int     // mailbox read, or -1
+	Write   int     // mailbox written, or -1
+	In      bool    // IN consumed a value
+	Out     bool    // OUT or OTC produced a value
+	Value   int     // value consumed or produced
+	Channel Channel // channel of the value produced
+	// Device is set if the step interacted with a device.
+	Device *DeviceEvent
+}
+
+// Machine is a single LMC.
+type Machine struct {
+	Mem    []int
+	Acc    int
+	PC     int
+	Neg    bool
+	SP     int // top of the stack, see StackSize
+	Input  []int
+	Output []int
+	// Channels[i] is the channel that Output[i] was written
+	// to.
+	Channels []Channel
+	// In and Out, if set, are used by IN and OUT instead of
+	// Input. Output is always recorded.
+	In     InputSource
+	Out    OutputSink
+	Halted bool
+	// when Strict is set, undefined instructions stop the
+	// machine instead of being treated as no-ops like the
+	// OG simulator does.
+	Strict bool
+	// Dialect decides which 9xx instructions are defined and
+	// how the negative flag behaves. nil is the same as OG.
+	Dialect *Dialect
+	// Arithmetic is what ADD and SUB do on overflow and
+	// underflow, see Arithmetic.
+	Arithmetic Arithmetic
+	// StackSize is the number of mailboxes at the end of Mem
+	// reserved for the stack. 0 disables the stack extension.
+	StackSize int
+	// Geometry is the size of the machine, which has to match
+	// the length of Mem. The zero value is Standard.
+	Geometry Geometry
+	Cycles   int    // no of instructions executed
+	Last     Effect // effect of the last step
+	// Observers are notified before and after each step.
+	// They are shared between clones of the machine unless
+	// they implement Cloner.
+	Observers []Observer
+	// HistoryLimit is the maximum number of steps kept in the
+	// undo log, 0 disables it.
+	HistoryLimit int
+	image        []int    // never written to, so it is shared by clones
+	prog         *Program // program the image came from, if any
+	read         int      // no of inputs consumed
+	history      []undo
+	pending      []int // inputs read before In/Input, e.g. given back by StepBack
+	cache        decodeCache
+	slow         bool // never use the decode cache or runFast, for tests
+	devices      []Device
+	ports        map[int]port // by the last 2 digits of the code
+	mapped       []MemoryDevice
+}
+
+func newMachineFromSlice(g Geometry, mailboxes []int) *Machine {
+	g = g.orStandard()
+	vm := Machine{Geometry: g}
+	// Size of mailboxes bounded by the geometry since
+	// we're accepting input from the `Compile`
+	// function.
+	vm.Mem = make([]int, g.Mailboxes)
+	copy(vm.Mem, mailboxes)
+	// keep a pristine copy of the compiled image around
+	// so that the machine can be restored later on
+	vm.image = append([]int(nil), vm.Mem...)
+	vm.SP = len(vm.Mem)
+	return &vm
+}
+
+// NewMachine returns a machine loaded with the program.
+func NewMachine(p *Program) *Machine {
+	vm := newMachineFromSlice(p.Geometry, p.Mem)
+	vm.StackSize = p.StackSize
+	vm.prog = p
+	vm.Dialect = p.Dialect
+	return vm
+}
+
+// Program returns the program that the machine was loaded
+// with.
+func (c *Machine) Program() *Program {
+	return c.prog
+}
+
+// Clone returns a copy of the machine which can be run
+// independently of the original. In and Out are not copied,
+// since sources and sinks cannot be shared, so the clone reads
+// from Input until they are set again.
+func (c *Machine) Clone() *Machine {
+	vm := *c
+	vm.Mem = append([]int(nil), c.Mem...)
+	vm.Input = append([]int(nil), c.Input...)
+	vm.Output = append([]int(nil), c.Output...)
+	vm.Channels = append([]Channel(nil), c.Channels...)
+	vm.In = nil
+	vm.Out = nil
+	vm.cache = decodeCache{}
+	vm.history = append([]undo(nil), c.history...)
+	vm.pending = append([]int(nil), c.pending...)
+	c.cloneDevices(&vm)
+	vm.Observers = make([]Observer, len(c.Observers))
+	for i, o := range c.Observers {
+		if cloner, ok := o.(Cloner); ok {
+			o = cloner.Clone()
+		}
+		vm.Observers[i] = o
+	}
+	return &vm
+}
+
+// Reset clears the input, output, program counter and stack,
+// but leaves the memory and accumulator untouched.
+func (c *Machine) Reset() {
+	c.Input = []int{}
+	c.Output = []int{}
+	c.Channels = nil
+	c.Halted = false
+	c.PC = 0
+	c.SP = len(c.Mem)
+	c.Cycles = 0
+	c.read = 0
+	c.history = nil
+	c.pending = nil
+}
+
+// Restore brings the machine back to the state it was in
+// right after it was created: memory is restored from the
+// compiled image, all registers are cleared and observers
+// which implement Rewinder are reset.
+func (c *Machine) Restore() {
+	c.Reset()
+	copy(c.Mem, c.image)
+	c.Acc = 0
+	c.Neg = false
+	for _, d := range c.devices {
+		d.Reset()
+	}
+	c.resetObservers()
+}
+
+// resetObservers resets the observers which implement Rewinder.
+func (c *Machine) resetObservers() {
+	for _, o := range c.Observers {
+		if r, ok := o.(Rewinder); ok {
+			r.Reset()
+		}
+	}
+}
+
+// Set sets a mailbox from outside of the program, e.g. from a
+// debugger. The value goes to the device mapped to the mailbox,
+// if any, the write can be undone by StepBack, and observers
+// which implement WriteObserver are told about it.
+func (c *Machine) Set(mailbox int, value int) error {
+	g := c.geometry()
+	if mailbox < 0 || mailbox >= len(c.Mem) {
+		return fmt.Errorf("mailbox %d is out of range", mailbox)
+	}
+	if value < 0 || value > g.Max() {
+		return fmt.Errorf("%d does not fit in %d digits", value, g.Digits)
+	}
+	if c.HistoryLimit > 0 {
+		c.record()
+		u := c.last()
+		u.set = true
+		u.addr = mailbox
+		u.old = c.Mem[mailbox]
+	}
+	c.Mem[mailbox] = value
+	if m, offset, ok := c.device(mailbox); ok {
+		m.Store(offset, value)
+	}
+	for _, o := range c.Observers {
+		if w, ok := o.(WriteObserver); ok {
+			w.Written(c, mailbox)
+		}
+	}
+	return nil
+}
+
+// Locate returns the location of the given mailbox.
+func (c *Machine) Locate(pc int) Location {
+	loc := Location{PC: pc, Cycles: c.Cycles, Acc: c.Acc, Digits: c.geometry().Digits}
+	if pc >= 0 && pc < len(c.Mem) {
+		loc.Instr = c.Mem[pc]
+		loc.Mnemonic = c.Mnemonic(loc.Instr)
+	}
+	if c.prog != nil {
+		loc.Line = c.prog.LineAt(pc)
+	}
+	return loc
+}
+
+func (c *Machine) geometry() Geometry {
+	return c.Geometry.orStandard()
+}
+
+// Mnemonic returns the name of the instruction stored in a
+// mailbox, taking the dialect and geometry into account.
+func (c *Machine) Mnemonic(word int) string {
+	std, ok := c.geometry().standard(word)
+	if !ok {
+		return "???"
+	}
+	if name, ok := stackNames[std]; ok && c.StackSize > 0 {
+		return name
+	}
+	if p, ok := c.ports[std-900]; ok {
+		return p.name
+	}
+	return c.dialect().Mnemonic(std)
+}
+
+// defines reports whether the instruction is defined.
+func (c *Machine) defines(instr Instruction) bool {
+	return c.Mnemonic(instr.Word) != "???"
+}
+
+func (c *Machine) dialect() *Dialect {
+	if c.Dialect == nil {
+		return OG
+	}
+	return c.Dialect
+}
+
+// read1 reads a single value from In, or from Input if In
+// is not set.
+func (c *Machine) read1() (int, error) {
+	if len(c.pending) > 0 {
+		n := c.pending[0]
+		c.pending = c.pending[1:]
+		return n, nil
+	}
+	if c.In != nil {
+		return c.In.Read()
+	}
+	if len(c.Input) == 0 {
+		return 0, ErrNoMoreInput
+	}
+	n := c.Input[0]
+	c.Input = c.Input[1:]
+	return n, nil
+}
+
+// write writes a value to Out, if it is set.
+func (c *Machine) write(n int, ch Channel) error {
+	if s, ok := c.Out.(ChannelSink); ok {
+		return s.WriteChannel(n, ch)
+	}
+	if c.Out != nil {
+		return c.Out.Write(n)
+	}
+	return nil
+}
+
+// Step fetches and executes a single instruction, notifying
+// the observers before and after it is executed.
+func (c *Machine) Step() error {
+	pc := c.PC
+	if pc >= len(c.Mem) {
+		c.Halted = true
+		return PCOverflowError{c.Locate(pc)}
+	}
+	instr := c.fetch(pc)
+	for _, o := range c.Observers {
+		if err := o.BeforeStep(c, pc, instr); err != nil {
+			c.Halted = true
+			return err
+		}
+	}
+	if err := c.execute(pc, instr); err != nil {
+		return err
+	}
+	for _, o := range c.Observers {
+		if err := o.AfterStep(c, c.Last); err != nil {
+			c.Halted = true
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Machine) execute(pc int, instr Instruction) (err error) {
+	if c.HistoryLimit > 0 {
+		c.record()
+	}
+	u := c.last()
+	c.Last = Effect{PC: pc, Instr: instr.Word, Read: -1, Write: -1}
+	c.PC++
+	c.Cycles++
+	addr := instr.Addr
+	switch instr.Opcode {
+	case 1, 2, 3, 5:
+		if addr >= len(c.Mem) {
+			c.Halted = true
+			return AddressError{c.Locate(pc), addr}
+		}
+	}
+	switch instr.Opcode {
+	case 0: // HLT
+		c.Halted = true
+	case 1: // ADD
+		c.Last.Read = addr
+		r := c.Acc + c.load(addr)
+		c.Neg = r < 0 && c.dialect().Neg == NegResult
+		c.Acc = c.Arithmetic.fit(r, c.geometry().Max())
+	case 2: // SUB
+		c.Last.Read = addr
+		r := c.Acc - c.load(addr)
+		if r < 0 {
+			c.Neg = true
+		} else if c.dialect().Neg == NegResult {
+			c.Neg = false
+		}
+		c.Acc = c.Arithmetic.fit(r, c.geometry().Max())
+	case 3: // STO
+		if u != nil {
+			u.addr = addr
+			u.old = c.Mem[addr]
+		}
+		c.Last.Write = addr
+		c.Mem[addr] = c.Acc
+		c.store(addr, c.Acc)
+	case 4: // CALL, undefined without the stack extension
+		if c.StackSize > 0 {
+			err = c.push(pc, c.PC, u)
+			if err == nil {
+				c.PC = addr
+			}
+		} else if c.Strict {
+			c.Halted = true
+			err = IllegalInstructionError{c.Locate(pc)}
+		}
+	case 5: // LDA
+		c.Last.Read = addr
+		c.Neg = false
+		c.Acc = c.load(addr)
+	case 6: // BR
+		c.PC = addr
+	case 7: // BRZ
+		if c.Acc == 0 {
+			c.PC = addr
+		}
+	case 8: // BRP
+		if !c.Neg {
+			c.PC = addr
+		}
+	case 9:
+		// 901 => IN
+		if addr == 1 {
+			n, e := c.read1()
+			if e != nil {
+				c.Halted = true
+				if e == io.EOF || e == ErrNoMoreInput {
+					e = OutOfInputError{c.Locate(pc), c.read}
+				}
+				return e
+			}
+			if n < 0 || n > c.geometry().Max() {
+				c.Halted = true
+				return InputRangeError{c.Locate(pc), n}
+			}
+			c.Acc = n
+			c.Neg = false
+			c.read++
+			c.Last.In = true
+			c.Last.Value = n
+			if u != nil {
+				u.input = true
+				u.value = n
+			}
+		}
+		// 902 => OUT, 922 => OTC
+		if addr == 2 || (addr == 22 && c.dialect().OTC) {
+			ch := Numeric
+			if addr == 22 {
+				ch = Char
+			}
+			c.Output = append(c.Output, c.Acc)
+			c.Channels = append(c.Channels, ch)
+			c.Last.Out = true
+			c.Last.Value = c.Acc
+			c.Last.Channel = ch
+			if u != nil {
+				u.output = true
+			}
+			if e := c.write(c.Acc, ch); e != nil {
+				c.Halted = true
+				return e
+			}
+		}
+		if c.StackSize > 0 {
+			switch addr {
+			case 11: // PUSH
+				err = c.push(pc, c.Acc, u)
+			case 12: // POP
+				var n int
+				if n, err = c.pop(pc); err == nil {
+					c.Acc = n
+					c.Neg = false
+				}
+			case 13: // RET
+				var n int
+				if n, err = c.pop(pc); err == nil {
+					c.PC = n
+				}
+			}
+		}
+		if c.ports != nil {
+			var ok bool
+			if ok, err = c.execPort(addr); ok {
+				if err != nil {
+					c.Halted = true
+				}
+				return
+			}
+		}
+		if !c.defines(instr) && c.Strict {
+			c.Halted = true
+			err = IllegalInstructionError{c.Locate(pc)}
+		}
+	}
+	return
+}
+
+// Run steps through the program until the machine halts.
+func (c *Machine) Run() (output []int, err error) {
+	if limit, ok := c.fastLimit(); ok {
+		err = c.runFast(context.Background(), limit)
+		return c.Output, err
+	}
+	for !c.Halted {
+		err = c.Step()
+		if err != nil {
+			break
+		}
+	}
+	output = c.Output
+	return
+}
+
+// how many steps RunContext takes between checking whether
+// the context is done
+const contextCheckInterval = 256
+
+// RunContext is like Run, but stops with a CancelledError once
+// the context is done. Reads from In are not interrupted.
+func (c *Machine) RunContext(ctx context.Context) (output []int, err error) {
+	if limit, ok := c.fastLimit(); ok {
+		err = c.runFast(ctx, limit)
+		return c.Output, err
+	}
+	for i := 0; !c.Halted; i++ {
+		if i%contextCheckInterval == 0 && ctx.Err() != nil {
+			c.Halted = true
+			err = CancelledError{c.Locate(c.PC), ctx.Err()}
+			break
+		}
+		err = c.Step()
+		if err != nil {
+			break
+		}
+	}
+	output = c.Output
+	return
+}
@@ -0,0 +1,288 @@
+package lmc
+
+import "time"
+import "errors"
+import "context"
+import "strings"
+import "testing"
+import "github.com/stretchr/testify/assert"
+
+func TestVMIO(t *testing.T) {
+	r := strings.NewReader(`
+	IN
+	STO	small
+	IN		
+	STO	big
+	SUB	small # Next check that we received the smaller first
+	BRP	ok	# no need to exchange
+	LDA	small	# exchange
+	STO	temp
+	LDA	big
+	STO	small
+	LDA	temp
+	STO	big 
+ok	LDA	small	# add 1 to small
+	ADD	one	# constant
+	STO	small
+while	SUB	big
+	BRP	endw	# not smaller any more
+	LDA	small	# display small
+	OUT
+	ADD	one	# add 1 to small
+	STO	small
+	BR	while	# loop back
+endw	HLT		# stop
+one	DAT	001	# defining a constant
+small	DAT		# space for data value
+big	DAT		# space for data value
+temp	DAT	# space for data value
+	`)
+	prog, errs := Compile(r)
+	assert.Equal(t, len(errs), 0, "No errors in compilation")
+	vm := NewMachine(prog)
+	vm.Input = []int{10, 20}
+	output, err := vm.Run()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, output, []int{11, 12, 13, 14, 15, 16, 17, 18, 19})
+	// check that once we reset, all inputs are reset and the
+	// ErrNoMoreInput error is returned
+	vm.Reset()
+	_, err = vm.Run()
+	assert.Equal(t, errors.Is(err, ErrNoMoreInput), true)
+	assert.Equal(t, err.Error(), "line 2 (mailbox 00, IN): no more input after 0 values")
+}
+
+func TestVMBR(t *testing.T) {
+	r := strings.NewReader(`
+	LDA	i
+	BRZ	k
+	BRP	h
+	BR	h
+k	LDA j
+h	OUT
+	HLT
+i	DAT	99
+j	DAT 88`)
+	prog, errors := Compile(r)
+	assert.Equal(t, len(errors), 0, "No errors in compilation")
+	vm := NewMachine(prog)
+	vm.Input = []int{}
+	output, err := vm.Run()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, output, []int{99})
+	// check that BRZ works properly
+	vm.Mem[7] = 0
+	vm.Reset()
+	output, err = vm.Run()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, output, []int{88})
+}
+
+func TestVMRestore(t *testing.T) {
+	r := strings.NewReader(`
+	IN
+	SUB	x
+	STO	x
+	OUT
+	HLT
+x	DAT	5`)
+	prog, errors := Compile(r)
+	assert.Equal(t, len(errors), 0, "No errors in compilation")
+	vm := NewMachine(prog)
+	vm.Input = []int{1}
+	output, err := vm.Run()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, output, []int{996})
+	assert.Equal(t, vm.Neg, true)
+	// restoring should give us back the original image
+	// and clear the registers
+	vm.Restore()
+	assert.Equal(t, vm.Mem[5], 5)
+	assert.Equal(t, vm.Acc, 0)
+	assert.Equal(t, vm.Neg, false)
+	assert.Equal(t, vm.PC, 0)
+	vm.Input = []int{1}
+	output, err = vm.Run()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, output, []int{996})
+}
+
+func TestVMClone(t *testing.T) {
+	prog, errors := Compile(strings.NewReader(`
+loop	IN
+	OUT
+	BR	loop`))
+	assert.Equal(t, len(errors), 0, "No errors in compilation")
+	vm := NewMachine(prog)
+	vm.In = NewSliceInput([]int{1, 1, 1, 2})
+	for i := 0; i < 9; i++ {
+		assert.Equal(t, vm.Step(), nil)
+	}
+	assert.Equal(t, vm.Output, []int{1, 1, 1})
+	// the clone has its own output, and does not take the
+	// input of the original
+	clone := vm.Clone()
+	clone.Input = []int{501}
+	assert.Equal(t, clone.Step(), nil)
+	assert.Equal(t, clone.Step(), nil)
+	assert.Equal(t, vm.Step(), nil)
+	assert.Equal(t, vm.Step(), nil)
+	assert.Equal(t, clone.Output, []int{1, 1, 1, 501})
+	assert.Equal(t, vm.Output, []int{1, 1, 1, 2})
+}
+
+func TestVMSet(t *testing.T) {
+	prog, errors := Compile(strings.NewReader(`
+	LDA	x
+	STO	90
+	HLT
+x	DAT`))
+	assert.Equal(t, len(errors), 0, "No errors in compilation")
+	vm := NewMachine(prog)
+	display := NewDisplay(90, 1)
+	assert.Equal(t, vm.Attach(display), nil)
+	vm.HistoryLimit = 10
+	d := NewUninitDetector(true)
+	vm.Observers = []Observer{d}
+	assert.Equal(t, vm.Set(3, 1000).Error(), "1000 does not fit in 3 digits")
+	assert.Equal(t, vm.Set(100, 1).Error(), "mailbox 100 is out of range")
+	// a set mailbox is initialized, and goes to the device
+	assert.Equal(t, vm.Set(3, 8), nil)
+	assert.Equal(t, vm.Set(90, 5), nil)
+	assert.Equal(t, display.String(), "5")
+	assert.Equal(t, vm.History(), 2)
+	_, _, ok := vm.LastWrite(3)
+	assert.Equal(t, ok, false)
+	_, err := vm.Run()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, vm.Mem[90], 8)
+	// and can be undone like a step
+	for vm.StepBack() == nil {
+	}
+	assert.Equal(t, vm.Mem[3], 0)
+}
+
+func TestVMStrict(t *testing.T) {
+	r := strings.NewReader(`
+	LDA	x
+	OUT
+x	DAT	404
+	HLT`)
+	prog, errors := Compile(r)
+	assert.Equal(t, len(errors), 0, "No errors in compilation")
+	vm := NewMachine(prog)
+	// permissive mode treats 404 as a no-op
+	output, err := vm.Run()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, output, []int{404})
+	vm.Restore()
+	vm.Strict = true
+	output, err = vm.Run()
+	assert.Equal(t, err, IllegalInstructionError{Location{2, 404, 3, 404, prog.Lines[2], "???", 3}})
+	assert.Equal(t, err.Error(), "line 4 (mailbox 02, DAT): illegal instruction 404")
+	assert.Equal(t, output, []int{404})
+	// undefined 9xx instructions are illegal as well
+	vm.Restore()
+	vm.Mem[2] = 903
+	_, err = vm.Run()
+	assert.Equal(t, err, IllegalInstructionError{Location{2, 903, 3, 903, prog.Lines[2], "???", 3}})
+}
+
+func TestVMOutOfInput(t *testing.T) {
+	r := strings.NewReader(`
+loop	IN
+	OUT
+	BR	loop`)
+	prog, errors := Compile(r)
+	assert.Equal(t, len(errors), 0, "No errors in compilation")
+	vm := NewMachine(prog)
+	vm.Input = []int{1, 2, 3}
+	output, err := vm.Run()
+	assert.Equal(t, output, []int{1, 2, 3})
+	assert.Equal(t, err, OutOfInputError{Location{0, 901, 10, 3, prog.Lines[0], "IN", 3}, 3})
+	assert.Equal(t, err.Error(), "line 2 (mailbox 00, IN): no more input after 3 values")
+}
+
+func TestVMInputRange(t *testing.T) {
+	r := strings.NewReader(`
+	IN
+	STO	x
+	HLT
+x	DAT`)
+	prog, errors := Compile(r)
+	assert.Equal(t, len(errors), 0, "No errors in compilation")
+	for _, n := range []int{-7, 1000} {
+		vm := NewMachine(prog)
+		vm.In = NewSliceInput([]int{n})
+		_, err := vm.Run()
+		assert.Equal(t, err, InputRangeError{Location{0, 901, 1, 0, prog.Lines[0], "IN", 3}, n})
+		assert.Equal(t, vm.Mem[3], 0)
+	}
+	vm := NewMachine(prog)
+	vm.Input = []int{-7}
+	_, err := vm.Run()
+	assert.Equal(t, err.Error(), "line 2 (mailbox 00, IN): input -7 does not fit in 3 digits")
+}
+
+func TestVMPCOverflow(t *testing.T) {
+	vm := newMachineFromSlice(Standard, []int{})
+	// fill memory with no-ops so that the pc runs off the end
+	for i := range vm.Mem {
+		vm.Mem[i] = 400
+	}
+	_, err := vm.Run()
+	assert.Equal(t, err, PCOverflowError{Location{100, 0, 100, 0, nil, "", 3}})
+	assert.Equal(t, err.Error(), "mailbox 100: program counter ran past the last mailbox after 100 cycles")
+}
+
+func TestVMEffect(t *testing.T) {
+	r := strings.NewReader(`
+	IN
+	ADD	x
+	STO	x
+	OUT
+x	DAT	1`)
+	prog, errs := Compile(r)
+	assert.Equal(t, len(errs), 0, "No errors in compilation")
+	vm := NewMachine(prog)
+	vm.Input = []int{5}
+	effects := []Effect{
+		Effect{PC: 0, Instr: 901, Read: -1, Write: -1, In: true, Value: 5},
+		Effect{PC: 1, Instr: 104, Read: 4, Write: -1},
+		Effect{PC: 2, Instr: 304, Read: -1, Write: 4},
+		Effect{PC: 3, Instr: 902, Read: -1, Write: -1, Out: true, Value: 6},
+	}
+	for _, e := range effects {
+		vm.Step()
+		assert.Equal(t, vm.Last, e)
+	}
+}
+
+func TestVMRunContext(t *testing.T) {
+	r := strings.NewReader(`
+loop	OUT
+	BR	loop`)
+	prog, errs := Compile(r)
+	assert.Equal(t, len(errs), 0, "No errors in compilation")
+	vm := NewMachine(prog)
+	ctx, cancel := context.WithCancel(context.Background())
+	n := 0
+	vm.Observers = []Observer{ObserverFuncs{After: func(m *Machine, e Effect) error {
+		n++
+		if n == 1000 {
+			cancel()
+		}
+		return nil
+	}}}
+	output, err := vm.RunContext(ctx)
+	assert.Equal(t, errors.Is(err, context.Canceled), true)
+	assert.Equal(t, vm.Cycles, 1024)
+	assert.Equal(t, len(output), 512)
+	assert.Equal(t, err.Error(), "line 2 (mailbox 00, OUT): stopped after 1024 cycles: context canceled")
+	// deadlines are honoured as well
+	vm.Restore()
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	_, err = vm.RunContext(ctx)
+	assert.Equal(t, errors.Is(err, context.DeadlineExceeded), true)
+}